@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/a-kataev/go-influxdb-writer/internal/cli"
+)
+
+func main() {
+	flags := cli.NewFlags(flag.CommandLine)
+	rate := flag.Float64("rate", 0, "lines per second, 0 disables the limit")
+	checkpointPath := flag.String("checkpoint", "", "checkpoint file to resume from")
+	interval := flag.Uint64("checkpoint-lines", 100000, "lines between checkpoints")
+	flushTimeout := flag.Duration("flush-timeout", 5*time.Minute, "time to wait for a checkpoint to be sent")
+	dryRun := flag.Bool("dry-run", false, "validate files without sending")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	if err := cli.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	checkpoint, err := loadCheckpoint(*checkpointPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	r := &replayer{
+		checkpoint:   checkpoint,
+		limiter:      newLimiter(*rate),
+		interval:     *interval,
+		flushTimeout: *flushTimeout,
+		out:          os.Stderr,
+	}
+
+	if !*dryRun {
+		options, err := flags.Options()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		r.serverURL = options.Client.ServerURL
+		r.writer = writer.NewWriterWithOptions(options.
+			SetErrorHandler(r.errorHandler))
+	}
+
+	code := 0
+
+	for _, path := range flag.Args() {
+		if err := r.replay(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+
+			break
+		}
+	}
+
+	if r.writer != nil {
+		r.writer.Close()
+	}
+
+	if r.summary.Invalid > 0 {
+		code = 1
+	}
+
+	fmt.Fprintf(os.Stderr, "files: %d, lines: %d, sent: %d, invalid: %d, rejected: %d, skipped: %d\n",
+		r.summary.Files, r.summary.Lines, r.summary.Sent, r.summary.Invalid,
+		atomic.LoadUint64(&r.summary.Rejected), r.summary.Skipped)
+
+	os.Exit(code)
+}
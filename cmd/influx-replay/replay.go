@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/a-kataev/go-influxdb-writer/internal/cli"
+	"github.com/a-kataev/go-influxdb-writer/internal/lineprotocol"
+)
+
+// position is the replay position in a file, with the bucket and the server
+// set by the markers before it.
+type position struct {
+	Offset int64  `json:"offset"`
+	Line   uint64 `json:"line"`
+	Done   bool   `json:"done"`
+	Bucket string `json:"bucket,omitempty"`
+	Server string `json:"server,omitempty"`
+}
+
+// The markers of dead letter files set the bucket and the server of the
+// following lines, empty ones select the default bucket and the primary
+// server.
+var (
+	bucketMarker = []byte("#bucket ")
+	serverMarker = []byte("#server ")
+)
+
+type checkpoint struct {
+	path  string
+	Files map[string]position `json:"files"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:  path,
+		Files: make(map[string]position),
+	}
+
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+
+	if c.Files == nil {
+		c.Files = make(map[string]position)
+	}
+
+	return c, nil
+}
+
+func (c *checkpoint) set(file string, pos position) error {
+	c.Files[file] = pos
+
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+type limiter struct {
+	rate    float64
+	started time.Time
+	count   uint64
+}
+
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &limiter{
+		rate:    rate,
+		started: time.Now(),
+	}
+}
+
+func (l *limiter) wait() {
+	if l == nil {
+		return
+	}
+
+	l.count++
+
+	due := l.started.Add(time.Duration(float64(l.count) / l.rate * float64(time.Second)))
+	if delay := time.Until(due); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type summary struct {
+	Files    uint64
+	Lines    uint64
+	Sent     uint64
+	Invalid  uint64
+	Rejected uint64
+	Skipped  uint64
+}
+
+type replayer struct {
+	writer writer.Writer
+	// serverURL is the server of the writer, lines of other servers are
+	// skipped.
+	serverURL    string
+	checkpoint   *checkpoint
+	limiter      *limiter
+	interval     uint64
+	flushTimeout time.Duration
+	out          io.Writer
+	summary      summary
+	// rejected is the number of rejected lines at the last commit.
+	rejected uint64
+}
+
+func (r *replayer) errorHandler(err *writer.WriteError) {
+	atomic.AddUint64(&r.summary.Rejected, uint64(len(err.Rejected)))
+}
+
+func (r *replayer) replay(path string) error {
+	name, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	pos := r.checkpoint.Files[name]
+	if pos.Done {
+		fmt.Fprintf(r.out, "%s: already replayed\n", path)
+
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	input, err := cli.Open(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, input, pos.Offset); err != nil {
+		return fmt.Errorf("%s: skip to offset %d: %w", path, pos.Offset, err)
+	}
+
+	r.summary.Files++
+
+	reader := bufio.NewReader(input)
+	pending := uint64(0)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			pos.Offset += int64(len(line))
+			pos.Line++
+
+			line = bytes.TrimRight(line, "\r\n")
+
+			switch {
+			case bytes.HasPrefix(line, bucketMarker):
+				pos.Bucket = string(line[len(bucketMarker):])
+			case bytes.HasPrefix(line, serverMarker):
+				pos.Server = string(line[len(serverMarker):])
+			case len(line) == 0 || line[0] == '#':
+			default:
+				r.summary.Lines++
+
+				if err := lineprotocol.Validate(line); err != nil {
+					r.summary.Invalid++
+					fmt.Fprintf(r.out, "%s:%d: %s\n", path, pos.Line, err)
+				} else if r.writer != nil {
+					if len(pos.Server) > 0 && pos.Server != r.serverURL {
+						r.summary.Skipped++
+					} else {
+						r.limiter.wait()
+						r.writer.WriteToBucket(pos.Bucket, line)
+						pending++
+					}
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, pos.Line, err)
+		}
+
+		if r.interval > 0 && pending >= r.interval {
+			if err := r.commit(name, pos, pending); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, pos.Line, err)
+			}
+
+			pending = 0
+		}
+	}
+
+	pos.Done = true
+
+	if err := r.commit(name, pos, pending); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (r *replayer) commit(name string, pos position, pending uint64) error {
+	if r.writer == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.flushTimeout)
+	defer cancel()
+
+	if err := r.writer.Flush(ctx); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	rejected := atomic.LoadUint64(&r.summary.Rejected)
+	r.summary.Sent += pending - (rejected - r.rejected)
+	r.rejected = rejected
+
+	if err := r.checkpoint.set(name, pos); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLogger struct{}
+
+func (l *nopLogger) Infof(template string, args ...interface{}) {}
+
+func (l *nopLogger) Errorf(template string, args ...interface{}) {}
+
+func writeFile(t *testing.T, path string, data string, compress bool) {
+	content := []byte(data)
+
+	if compress {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		_, err := gz.Write(content)
+		assert.Nil(t, err)
+		assert.Nil(t, gz.Close())
+		content = buf.Bytes()
+	}
+
+	assert.Nil(t, ioutil.WriteFile(path, content, 0o644))
+}
+
+func Test_checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	c, err := loadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Empty(t, c.Files)
+
+	assert.Nil(t, c.set("/a.lp", position{Offset: 10, Line: 2}))
+
+	c, err = loadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]position{"/a.lp": {Offset: 10, Line: 2}}, c.Files)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{"), 0o644))
+
+	_, err = loadCheckpoint(path)
+	assert.NotNil(t, err)
+}
+
+func Test_limiter(t *testing.T) {
+	assert.Nil(t, newLimiter(0))
+	newLimiter(0).wait()
+
+	l := newLimiter(100)
+	started := time.Now()
+
+	for i := 0; i < 5; i++ {
+		l.wait()
+	}
+
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+}
+
+func Test_replay(t *testing.T) {
+	mu := sync.Mutex{}
+	received := make([]string, 0)
+	fail := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.lp")
+	compressed := filepath.Join(dir, "compressed.lp.gz")
+
+	writeFile(t, plain, "# comment\ncpu v=1\r\n\ncpu v=\ncpu v=2\ncpu v=3", false)
+	writeFile(t, compressed, "mem v=1\nmem v=2\n", true)
+
+	newReplayer := func(checkpointPath string) (*replayer, *bytes.Buffer) {
+		c, err := loadCheckpoint(checkpointPath)
+		assert.Nil(t, err)
+
+		out := &bytes.Buffer{}
+		r := &replayer{
+			checkpoint:   c,
+			interval:     2,
+			flushTimeout: time.Second,
+			out:          out,
+		}
+		r.writer = writer.NewWriterWithOptions(writer.DefaultOptions().
+			SetServerURL(server.URL).
+			SetLogger(&nopLogger{}).
+			SetErrorHandler(r.errorHandler).
+			SetRetryMaxAttempts(1))
+
+		return r, out
+	}
+
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+
+	r, out := newReplayer(checkpointPath)
+	assert.Nil(t, r.replay(plain))
+	assert.Nil(t, r.replay(compressed))
+	r.writer.Close()
+
+	assert.Equal(t, []string{"cpu v=1", "cpu v=2", "cpu v=3", "mem v=1", "mem v=2"}, received)
+	assert.Contains(t, out.String(), "plain.lp:4: invalid line protocol")
+	assert.Equal(t, summary{Files: 2, Lines: 6, Sent: 5, Invalid: 1}, r.summary)
+
+	r, out = newReplayer(checkpointPath)
+	assert.Nil(t, r.replay(plain))
+	r.writer.Close()
+
+	assert.Contains(t, out.String(), "plain.lp: already replayed")
+	assert.Len(t, received, 5)
+
+	writeFile(t, compressed, "mem v=1\nmem v=2\nmem v=3\nmem v=4\n", true)
+
+	c, err := loadCheckpoint(checkpointPath)
+	assert.Nil(t, err)
+
+	name, _ := filepath.Abs(compressed)
+	assert.Nil(t, c.set(name, position{Offset: 16, Line: 2}))
+
+	r, _ = newReplayer(checkpointPath)
+	assert.Nil(t, r.replay(compressed))
+	r.writer.Close()
+
+	assert.Equal(t, []string{"mem v=3", "mem v=4"}, received[5:])
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+
+	assert.Nil(t, c.set(name, position{}))
+
+	r, _ = newReplayer(checkpointPath)
+	assert.NotNil(t, r.replay(compressed))
+	r.writer.Close()
+
+	c, err = loadCheckpoint(checkpointPath)
+	assert.Nil(t, err)
+	assert.Equal(t, position{}, c.Files[name])
+}
+
+func Test_replay_Rejected(t *testing.T) {
+	received := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if strings.Contains(string(body), `"x"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"invalid","message":"failed to parse line protocol:\nerrors encountered on line(s):\nline 2: field type conflict"}`))
+
+			return
+		}
+
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rejected.lp")
+	writeFile(t, path, "cpu v=1\ncpu v=\"x\"\ncpu v=3\n", false)
+
+	c, err := loadCheckpoint(filepath.Join(dir, "checkpoint.json"))
+	assert.Nil(t, err)
+
+	r := &replayer{
+		checkpoint:   c,
+		flushTimeout: time.Second,
+		out:          &bytes.Buffer{},
+	}
+	r.writer = writer.NewWriterWithOptions(writer.DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&nopLogger{}).
+		SetErrorHandler(r.errorHandler).
+		SetRetryMaxAttempts(1))
+
+	assert.Nil(t, r.replay(path))
+	r.writer.Close()
+
+	assert.Equal(t, []string{"cpu v=1", "cpu v=3"}, received)
+	assert.Equal(t, summary{Files: 1, Lines: 3, Sent: 2, Rejected: 1}, r.summary)
+
+	name, _ := filepath.Abs(path)
+	assert.True(t, c.Files[name].Done)
+}
+
+func Test_replay_Markers(t *testing.T) {
+	mu := sync.Mutex{}
+	received := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			received = append(received, r.URL.Query().Get("bucket")+": "+line)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "deadletter.lp")
+	writeFile(t, path, "cpu v=1\n#bucket audit\n#server http://replica:8086\ncpu v=2\n"+
+		"#server \ncpu v=3\n#bucket \ncpu v=4\n", false)
+
+	name, _ := filepath.Abs(path)
+
+	for _, pos := range []position{{}, {Offset: 67, Line: 5, Bucket: "audit"}} {
+		c := &checkpoint{Files: map[string]position{name: pos}}
+
+		r := &replayer{
+			checkpoint:   c,
+			serverURL:    server.URL,
+			flushTimeout: time.Second,
+			out:          &bytes.Buffer{},
+		}
+		r.writer = writer.NewWriterWithOptions(writer.DefaultOptions().
+			SetServerURL(server.URL).
+			SetBucket("default").
+			SetLogger(&nopLogger{}).
+			SetErrorHandler(r.errorHandler).
+			SetRetryMaxAttempts(1))
+
+		assert.Nil(t, r.replay(path))
+		r.writer.Close()
+
+		if pos.Offset == 0 {
+			assert.ElementsMatch(t, []string{"default: cpu v=1", "audit: cpu v=3", "default: cpu v=4"}, received)
+			assert.Equal(t, summary{Files: 1, Lines: 4, Sent: 3, Skipped: 1}, r.summary)
+		} else {
+			assert.ElementsMatch(t, []string{"audit: cpu v=3", "default: cpu v=4"}, received)
+		}
+
+		received = received[:0]
+	}
+}
+
+func Test_replay_DryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dry.lp")
+	writeFile(t, path, "cpu v=1\ncpu\n", false)
+
+	out := &bytes.Buffer{}
+	r := &replayer{
+		checkpoint: &checkpoint{Files: make(map[string]position)},
+		out:        out,
+	}
+
+	assert.Nil(t, r.replay(path))
+	assert.Equal(t, summary{Files: 1, Lines: 2, Invalid: 1}, r.summary)
+	assert.Contains(t, out.String(), "dry.lp:2: invalid line protocol")
+	assert.Empty(t, r.checkpoint.Files)
+}
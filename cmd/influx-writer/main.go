@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/a-kataev/go-influxdb-writer/internal/cli"
+)
+
+func main() {
+	flags := cli.NewFlags(flag.CommandLine)
+	shutdownTimeout := flag.Duration("shutdown-timeout", time.Minute, "time to send the remaining data on exit")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file...]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Reads line protocol from files or stdin. "+
+			"Every flag can be set with the %s<FLAG> environment variable.\n\n", cli.EnvPrefix)
+		flag.PrintDefaults()
+	}
+
+	if err := cli.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	options, err := flags.Options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &streamer{}
+	s.writer = writer.NewWriterWithOptions(options.
+		SetErrorHandler(s.errorHandler))
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	code := 0
+
+	for _, path := range paths {
+		if err := streamFile(ctx, s, path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+
+			break
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if _, err := s.writer.Shutdown(shutdownCtx); errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintln(os.Stderr, "shutdown: timed out, remaining data is dropped")
+	}
+
+	sent, failed := s.summary()
+	if failed > 0 {
+		code = 1
+	}
+
+	fmt.Fprintf(os.Stderr, "sent: %d, failed: %d\n", sent, failed)
+
+	os.Exit(code)
+}
+
+func streamFile(ctx context.Context, s *streamer, path string) error {
+	var file io.ReadCloser = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		file = f
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Closing the file interrupts a blocked read from a pipe.
+	go func() {
+		select {
+		case <-ctx.Done():
+			file.Close()
+		case <-done:
+		}
+	}()
+
+	input, err := cli.Open(file)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := s.stream(ctx, input); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+)
+
+type streamer struct {
+	writer  writer.Writer
+	written uint64
+	failed  uint64
+}
+
+func (s *streamer) errorHandler(err *writer.WriteError) {
+	if err.Dropped {
+		atomic.AddUint64(&s.failed, err.Entries)
+	}
+}
+
+func (s *streamer) stream(ctx context.Context, r io.Reader) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 && line[0] != '#' {
+			// Invalid lines and lines dropped by the overflow policy are
+			// counted as failed by the error handler.
+			_ = s.writer.WriteContext(ctx, line)
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			s.written++
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *streamer) summary() (sent, failed uint64) {
+	failed = atomic.LoadUint64(&s.failed)
+
+	return s.written - failed, failed
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLogger struct{}
+
+func (l *nopLogger) Infof(template string, args ...interface{}) {}
+
+func (l *nopLogger) Errorf(template string, args ...interface{}) {}
+
+func Test_stream(t *testing.T) {
+	mu := sync.Mutex{}
+	received := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.Contains(string(body), "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := &streamer{}
+	s.writer = writer.NewWriterWithOptions(writer.DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&nopLogger{}).
+		SetErrorHandler(s.errorHandler).
+		SetEntriesLimit(2).
+		SetValidateLines(true).
+		SetRetryMaxAttempts(1))
+
+	assert.Nil(t, s.stream(context.Background(),
+		strings.NewReader("# comment\ncpu v=1\r\n\ncpu v=2\ncpu\nbad v=1\nmem v=1")))
+	s.writer.Close()
+
+	sent, failed := s.summary()
+	assert.Equal(t, []string{"cpu v=1", "cpu v=2", "mem v=1"}, received)
+	assert.Equal(t, uint64(3), sent)
+	assert.Equal(t, uint64(2), failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s = &streamer{}
+	assert.Nil(t, s.stream(ctx, strings.NewReader("cpu v=1\n")))
+	assert.Equal(t, uint64(0), s.written)
+}
@@ -0,0 +1,161 @@
+package writer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DeadLetter interface {
+	Put(data []byte, err *WriteError) error
+}
+
+type deadLetterRecord struct {
+	Time       time.Time      `json:"time"`
+	Offset     int64          `json:"offset"`
+	Size       uint64         `json:"size"`
+	Entries    uint64         `json:"entries"`
+	StatusCode int            `json:"status_code,omitempty"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Bucket     string         `json:"bucket,omitempty"`
+	ServerURL  string         `json:"server_url,omitempty"`
+	Error      string         `json:"error"`
+	Rejected   []RejectedLine `json:"rejected,omitempty"`
+}
+
+type fileDeadLetter struct {
+	lock        sync.Mutex
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+	name        string
+	size        int64
+	// bucket and server are set by the last markers in the current file.
+	bucket string
+	server string
+}
+
+const (
+	deadLetterPrefix  = "deadletter-"
+	deadLetterExt     = ".lp"
+	deadLetterMetaExt = ".json"
+)
+
+// serverMarker starts a comment line, which sets the server of the following
+// lines in dead letter files, an empty one is the primary server.
+var serverMarker = []byte("#server ")
+
+func NewFileDeadLetter(dir string, maxFileSize int64, maxFiles int) (DeadLetter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileDeadLetter{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}, nil
+}
+
+func (d *fileDeadLetter) Put(data []byte, err *WriteError) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.name) == 0 || (d.maxFileSize > 0 && d.size > 0 && d.size+int64(len(data)) > d.maxFileSize) {
+		if err := d.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// The markers keep the bucket and the server of the batch in the file, so
+	// that the file can be replayed without the sidecar.
+	var markers []byte
+
+	if err.Bucket != d.bucket {
+		markers = append(append(append(markers, bucketMarker...), err.Bucket...), '\n')
+	}
+
+	if err.ServerURL != d.server {
+		markers = append(append(append(markers, serverMarker...), err.ServerURL...), '\n')
+	}
+
+	record := &deadLetterRecord{
+		Time:       time.Now().UTC(),
+		Offset:     d.size + int64(len(markers)),
+		Size:       uint64(len(data)),
+		Entries:    err.Entries,
+		StatusCode: err.StatusCode,
+		RequestID:  err.RequestID,
+		Bucket:     err.Bucket,
+		ServerURL:  err.ServerURL,
+		Error:      err.Error(),
+		Rejected:   err.Rejected,
+	}
+
+	meta, jsonErr := json.Marshal(record)
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	if err := appendFile(filepath.Join(d.dir, d.name+deadLetterExt), append(markers, data...)); err != nil {
+		return err
+	}
+
+	d.size += int64(len(markers) + len(data))
+	d.bucket, d.server = err.Bucket, err.ServerURL
+
+	return appendFile(filepath.Join(d.dir, d.name+deadLetterMetaExt), append(meta, '\n'))
+}
+
+func (d *fileDeadLetter) rotate() error {
+	d.name = deadLetterPrefix + time.Now().UTC().Format("20060102T150405.000000000")
+	d.size = 0
+	d.bucket, d.server = "", ""
+
+	if d.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, deadLetterPrefix) && strings.HasSuffix(name, deadLetterExt) {
+			names = append(names, strings.TrimSuffix(name, deadLetterExt))
+		}
+	}
+
+	sort.Strings(names)
+
+	for len(names) >= d.maxFiles {
+		_ = os.Remove(filepath.Join(d.dir, names[0]+deadLetterExt))
+		_ = os.Remove(filepath.Join(d.dir, names[0]+deadLetterMetaExt))
+		names = names[1:]
+	}
+
+	return nil
+}
+
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,119 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readDeadLetters(t *testing.T, dir string) ([]string, [][]deadLetterRecord) {
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+
+	data := make([]string, 0)
+	records := make([][]deadLetterRecord, 0)
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), deadLetterExt) {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), deadLetterExt)
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		assert.Nil(t, err)
+		data = append(data, string(content))
+
+		meta, err := os.Open(filepath.Join(dir, name+deadLetterMetaExt))
+		assert.Nil(t, err)
+
+		fileRecords := make([]deadLetterRecord, 0)
+		scanner := bufio.NewScanner(meta)
+		for scanner.Scan() {
+			record := deadLetterRecord{}
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+			fileRecords = append(fileRecords, record)
+		}
+		meta.Close()
+
+		records = append(records, fileRecords)
+	}
+
+	return data, records
+}
+
+func Test_fileDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+
+	deadLetter, err := NewFileDeadLetter(dir, 12, 2)
+	assert.Nil(t, err)
+
+	assert.Nil(t, deadLetter.Put([]byte("cpu v=1\n"), &WriteError{
+		Err:        errors.New("test"),
+		Entries:    1,
+		StatusCode: 400,
+		RequestID:  "id",
+		Bucket:     "audit",
+		Rejected:   []RejectedLine{{Line: "cpu v=1", Reason: "test"}},
+	}))
+	assert.Nil(t, deadLetter.Put([]byte("cpu v=2\n"), &WriteError{
+		Err:     errors.New("test"),
+		Entries: 1,
+	}))
+
+	data, records := readDeadLetters(t, dir)
+	assert.Equal(t, []string{"#bucket audit\ncpu v=1\n", "cpu v=2\n"}, data)
+	assert.Len(t, records, 2)
+	assert.Equal(t, int64(14), records[0][0].Offset)
+	assert.Equal(t, uint64(8), records[0][0].Size)
+	assert.Equal(t, uint64(1), records[0][0].Entries)
+	assert.Equal(t, 400, records[0][0].StatusCode)
+	assert.Equal(t, "id", records[0][0].RequestID)
+	assert.Equal(t, "audit", records[0][0].Bucket)
+	assert.Equal(t, "request_id: id, status_code: 400, error: test", records[0][0].Error)
+	assert.Equal(t, []RejectedLine{{Line: "cpu v=1", Reason: "test"}}, records[0][0].Rejected)
+	assert.Equal(t, "test", records[1][0].Error)
+
+	assert.Nil(t, deadLetter.Put([]byte("c=3\n"), &WriteError{Err: errors.New("test")}))
+
+	data, records = readDeadLetters(t, dir)
+	assert.Equal(t, []string{"#bucket audit\ncpu v=1\n", "cpu v=2\nc=3\n"}, data)
+	assert.Equal(t, int64(8), records[1][1].Offset)
+
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, deadLetter.Put([]byte("cpu v=4\n"), &WriteError{Err: errors.New("test")}))
+
+	data, _ = readDeadLetters(t, dir)
+	assert.Equal(t, []string{"cpu v=2\nc=3\n", "cpu v=4\n"}, data)
+
+	dir = t.TempDir()
+
+	deadLetter, err = NewFileDeadLetter(dir, 0, 0)
+	assert.Nil(t, err)
+
+	assert.Nil(t, deadLetter.Put([]byte("c=5\n"), &WriteError{Err: errors.New("test")}))
+	assert.Nil(t, deadLetter.Put([]byte("c=6\n"), &WriteError{
+		Err:       errors.New("test"),
+		Bucket:    "copy",
+		ServerURL: "http://replica:8086",
+	}))
+	assert.Nil(t, deadLetter.Put([]byte("c=7\n"), &WriteError{Err: errors.New("test")}))
+
+	data, records = readDeadLetters(t, dir)
+	assert.Equal(t, []string{
+		"c=5\n#bucket copy\n#server http://replica:8086\nc=6\n#bucket \n#server \nc=7\n",
+	}, data)
+	assert.Equal(t, int64(45), records[0][1].Offset)
+	assert.Equal(t, int64(67), records[0][2].Offset)
+
+	_, err = NewFileDeadLetter(filepath.Join(dir, records[0][0].Time.String(), "\x00"), 0, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,113 @@
+package writer
+
+import (
+	"strconv"
+	"time"
+)
+
+type pointEncoder struct {
+	point     *Point
+	precision time.Duration
+}
+
+func (e *pointEncoder) AppendLine(dst []byte) []byte {
+	return appendPoint(dst, e.point, e.precision)
+}
+
+var precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+func parsePrecision(precision string) time.Duration {
+	if d, ok := precisions[precision]; ok {
+		return d
+	}
+
+	return time.Nanosecond
+}
+
+const (
+	measurementEscapes = ", "
+	keyEscapes         = ",= "
+	stringEscapes      = "\"\\"
+)
+
+func appendPoint(dst []byte, p *Point, precision time.Duration) []byte {
+	dst = appendEscaped(dst, p.measurement, measurementEscapes)
+
+	for _, t := range p.tags {
+		if len(t.key) == 0 || len(t.value) == 0 {
+			continue
+		}
+
+		dst = append(dst, ',')
+		dst = appendEscaped(dst, t.key, keyEscapes)
+		dst = append(dst, '=')
+		dst = appendEscaped(dst, t.value, keyEscapes)
+	}
+
+	for i, f := range p.fields {
+		if i == 0 {
+			dst = append(dst, ' ')
+		} else {
+			dst = append(dst, ',')
+		}
+
+		dst = appendEscaped(dst, f.key, keyEscapes)
+		dst = append(dst, '=')
+		dst = appendField(dst, &p.fields[i])
+	}
+
+	if !p.time.IsZero() {
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, p.time.UnixNano()/int64(precision), 10)
+	}
+
+	return dst
+}
+
+func appendField(dst []byte, f *field) []byte {
+	switch f.kind {
+	case fieldInt:
+		dst = strconv.AppendInt(dst, f.i, 10)
+		dst = append(dst, 'i')
+	case fieldUint:
+		dst = strconv.AppendUint(dst, f.u, 10)
+		dst = append(dst, 'u')
+	case fieldFloat:
+		dst = strconv.AppendFloat(dst, f.f, 'f', -1, 64)
+	case fieldBool:
+		dst = strconv.AppendBool(dst, f.b)
+	case fieldString:
+		dst = append(dst, '"')
+		dst = appendEscaped(dst, f.s, stringEscapes)
+		dst = append(dst, '"')
+	}
+
+	return dst
+}
+
+func appendEscaped(dst []byte, s string, escapes string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		for j := 0; j < len(escapes); j++ {
+			if c == escapes[j] {
+				dst = append(dst, '\\')
+				break
+			}
+		}
+
+		dst = append(dst, c)
+	}
+
+	return dst
+}
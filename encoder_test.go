@@ -0,0 +1,93 @@
+package writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_appendPoint(t *testing.T) {
+	timestamp := time.Unix(1600000000, 123456789)
+
+	tables := []struct {
+		point     *Point
+		precision time.Duration
+		line      string
+	}{
+		{
+			point:     NewPoint("cpu").AddFloatField("value", 0.5),
+			precision: time.Nanosecond,
+			line:      "cpu value=0.5",
+		},
+		{
+			point: NewPoint("cpu").
+				AddTag("host", "server01").
+				AddTag("region", "").
+				AddIntField("int", -1).
+				AddUintField("uint", 1).
+				AddFloatField("float", 1e21).
+				AddBoolField("bool", true).
+				AddStringField("string", "test").
+				SetTime(timestamp),
+			precision: time.Nanosecond,
+			line:      `cpu,host=server01 int=-1i,uint=1u,float=1000000000000000000000,bool=true,string="test" 1600000000123456789`,
+		},
+		{
+			point: NewPoint("my measurement,1=").
+				AddTag("tag key,=", "tag value,=").
+				AddStringField("field key,=", `string "value" \ ,=`),
+			precision: time.Nanosecond,
+			line:      `my\ measurement\,1=,tag\ key\,\==tag\ value\,\= field\ key\,\=="string \"value\" \\ ,="`,
+		},
+		{
+			point:     NewPoint("cpu").AddBoolField("value", false).SetTime(timestamp),
+			precision: time.Millisecond,
+			line:      "cpu value=false 1600000000123",
+		},
+		{
+			point:     NewPoint("cpu").AddBoolField("value", false).SetTime(timestamp),
+			precision: time.Second,
+			line:      "cpu value=false 1600000000",
+		},
+	}
+
+	for tt, table := range tables {
+		line := appendPoint(nil, table.point, table.precision)
+		assert.Equalf(t, table.line, string(line), "%d", tt)
+	}
+}
+
+func Test_appendPoint_Allocs(t *testing.T) {
+	point := NewPoint("cpu").
+		AddTag("host", "server 01").
+		AddIntField("int", 1).
+		AddStringField("string", `"test"`).
+		SetTime(time.Now())
+
+	dst := make([]byte, 0, 1024)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = appendPoint(dst[:0], point, time.Nanosecond)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func Test_parsePrecision(t *testing.T) {
+	tables := []struct {
+		precision string
+		duration  time.Duration
+	}{
+		{"", time.Nanosecond},
+		{"ns", time.Nanosecond},
+		{"us", time.Microsecond},
+		{"ms", time.Millisecond},
+		{"s", time.Second},
+		{"h", time.Hour},
+		{"test", time.Nanosecond},
+	}
+
+	for tt, table := range tables {
+		assert.Equalf(t, table.duration, parsePrecision(table.precision), "%d", tt)
+	}
+}
@@ -0,0 +1,111 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/a-kataev/go-influxdb-writer/internal/client"
+	"github.com/a-kataev/go-influxdb-writer/internal/lineprotocol"
+)
+
+var (
+	ErrBucketRequired     = client.ErrBucketRequired
+	ErrOrgRequired        = client.ErrOrgRequired
+	ErrDatabaseRequired   = client.ErrDatabaseRequired
+	ErrInvalidLine        = lineprotocol.ErrInvalid
+	ErrClosed             = errors.New("writer is closed")
+	ErrOverflow           = errors.New("input queue is full")
+	ErrSpillFull          = errors.New("spill size exceeded")
+	ErrSpillDirRequired   = errors.New("spill dir is required")
+	ErrReplicaFull        = errors.New("replica queue is full")
+	ErrReplicaURLRequired = errors.New("replica server url is required")
+)
+
+type RejectedLine struct {
+	Line   string `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type WriteError struct {
+	Err         error
+	Size        uint64
+	Entries     uint64
+	StatusCode  int
+	RequestID   string
+	ServerError string
+	Response    string
+	// Bucket is set for batches routed to a bucket other than the default
+	// and for batches of replicas.
+	Bucket string
+	// ServerURL is set for batches of replicas.
+	ServerURL  string
+	Rejected   []RejectedLine
+	Retry      bool
+	Dropped    bool
+	temporary  bool
+	partial    bool
+	lineErrors []client.LineError
+}
+
+func (e *WriteError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("request_id: %s, status_code: %d, error: %s",
+			e.RequestID, e.StatusCode, e.Err)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+func newResponseError(serverError, response string) error {
+	if len(serverError) > 0 {
+		return errors.New(serverError)
+	}
+
+	return errors.New(response)
+}
+
+// ShutdownResult reports the entries delivered and lost since the writer was
+// created. Delivered and Lost are of the primary server, Replicas holds the
+// entries of every replica.
+type ShutdownResult struct {
+	Delivered uint64
+	Lost      uint64
+	Replicas  []ReplicaResult
+}
+
+// ReplicaResult reports the entries delivered to and lost by a replica.
+type ReplicaResult struct {
+	ServerURL string
+	Delivered uint64
+	Lost      uint64
+}
+
+// ShutdownError is returned by Shutdown when entries were lost, Err is the
+// context error when the shutdown was aborted.
+type ShutdownError struct {
+	Err error
+	ShutdownResult
+}
+
+func (e *ShutdownError) Error() string {
+	message := fmt.Sprintf("delivered: %d, lost: %d", e.Delivered, e.Lost)
+
+	for _, replica := range e.Replicas {
+		message += fmt.Sprintf(", replica: %s, delivered: %d, lost: %d",
+			replica.ServerURL, replica.Delivered, replica.Lost)
+	}
+
+	if e.Err != nil {
+		message += fmt.Sprintf(", error: %s", e.Err)
+	}
+
+	return message
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
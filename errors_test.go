@@ -0,0 +1,61 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WriteError(t *testing.T) {
+	testErr := errors.New("test")
+
+	tables := []struct {
+		err     *WriteError
+		message string
+	}{
+		{
+			err:     &WriteError{Err: testErr},
+			message: "test",
+		},
+		{
+			err: &WriteError{
+				Err:         newResponseError("test", ""),
+				StatusCode:  400,
+				RequestID:   "id",
+				ServerError: "test",
+			},
+			message: "request_id: id, status_code: 400, error: test",
+		},
+		{
+			err: &WriteError{
+				Err:        newResponseError("", "response"),
+				StatusCode: 500,
+				Response:   "response",
+			},
+			message: "request_id: , status_code: 500, error: response",
+		},
+	}
+
+	for tt, table := range tables {
+		assert.EqualErrorf(t, table.err, table.message, "%d", tt)
+	}
+
+	assert.True(t, errors.Is(&WriteError{Err: testErr}, testErr))
+}
+
+func Test_ShutdownError(t *testing.T) {
+	err := &ShutdownError{
+		Err: context.DeadlineExceeded,
+		ShutdownResult: ShutdownResult{
+			Delivered: 3,
+			Lost:      1,
+			Replicas:  []ReplicaResult{{ServerURL: "http://replica:8086", Delivered: 2, Lost: 2}},
+		},
+	}
+
+	assert.EqualError(t, err,
+		"delivered: 3, lost: 1, replica: http://replica:8086, delivered: 2, lost: 2, error: context deadline exceeded")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -4,6 +4,7 @@ package batch
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"io"
 	"sync"
@@ -15,33 +16,62 @@ type BatchReader struct {
 	Entries uint64
 }
 
+type Appender interface {
+	AppendLine(dst []byte) []byte
+}
+
 type Batch interface {
 	Write(e []byte) error
+	Append(a Appender) error
 	Reader() *BatchReader
+	Entries() uint64
+	Size() uint64
 	Reset()
 }
 
 type Options struct {
-	BufferSize   uint64
-	EntriesLimit uint64
+	BufferSize     uint64
+	EntriesLimit   uint64
+	CompressedSize bool
+	GzipLevel      int
+}
+
+type counter struct {
+	n uint64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.n += uint64(len(p))
+	return len(p), nil
 }
 
 type batch struct {
 	lock         sync.RWMutex
-	buffer       *bytes.Buffer
+	buffer       []byte
 	entries      uint64
 	bufferSize   uint64
 	entriesLimit uint64
+	gzip         *gzip.Writer
+	compressed   *counter
 }
 
 func New(options *Options) Batch {
 	b := &batch{
-		buffer:       bytes.NewBuffer([]byte{}),
+		buffer:       make([]byte, 0, options.BufferSize),
 		bufferSize:   options.BufferSize,
 		entriesLimit: options.EntriesLimit,
 	}
 
-	b.buffer.Grow(int(b.bufferSize))
+	if options.CompressedSize {
+		b.compressed = &counter{}
+
+		gz, err := gzip.NewWriterLevel(b.compressed, options.GzipLevel)
+		if err != nil {
+			gz = gzip.NewWriter(b.compressed)
+		}
+
+		b.gzip = gz
+	}
 
 	return b
 }
@@ -55,40 +85,92 @@ func (b *batch) Write(e []byte) error {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	if uint64(b.buffer.Len()+len(e)+1) >= b.bufferSize {
-		return ErrSizeExceeded
+	if b.entries+1 >= b.entriesLimit {
+		return ErrLimitExceeded
 	}
 
+	start := len(b.buffer)
+	b.buffer = append(b.buffer, e...)
+
+	return b.commit(start)
+}
+
+func (b *batch) Append(a Appender) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
 	if b.entries+1 >= b.entriesLimit {
 		return ErrLimitExceeded
 	}
 
-	_, _ = b.buffer.Write(e)
-	_, _ = b.buffer.WriteRune('\n')
+	start := len(b.buffer)
+	b.buffer = a.AppendLine(b.buffer)
+
+	return b.commit(start)
+}
+
+func (b *batch) commit(start int) error {
+	b.buffer = append(b.buffer, '\n')
+
+	if b.size(start)+uint64(len(b.buffer)-start) >= b.bufferSize {
+		b.buffer = b.buffer[:start]
+		return ErrSizeExceeded
+	}
+
+	if b.gzip != nil {
+		_, _ = b.gzip.Write(b.buffer[start:])
+	}
 
 	b.entries++
 
 	return nil
 }
 
+func (b *batch) size(end int) uint64 {
+	if b.gzip != nil {
+		return b.compressed.n
+	}
+
+	return uint64(end)
+}
+
 func (b *batch) Reader() *BatchReader {
 	b.lock.RLock()
 	defer b.lock.RUnlock()
 
-	copyBuffer := make([]byte, b.buffer.Len())
-	copy(copyBuffer, b.buffer.Bytes())
+	copyBuffer := make([]byte, len(b.buffer))
+	copy(copyBuffer, b.buffer)
 
 	return &BatchReader{
 		Reader:  bytes.NewReader(copyBuffer),
-		Size:    uint64(b.buffer.Len()),
+		Size:    uint64(len(b.buffer)),
 		Entries: b.entries,
 	}
 }
 
+func (b *batch) Entries() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.entries
+}
+
+func (b *batch) Size() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return uint64(len(b.buffer))
+}
+
 func (b *batch) Reset() {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.buffer.Reset()
+	b.buffer = b.buffer[:0]
 	b.entries = 0
+
+	if b.gzip != nil {
+		b.compressed.n = 0
+		b.gzip.Reset(b.compressed)
+	}
 }
@@ -1,7 +1,9 @@
 package batch
 
 import (
+	"compress/gzip"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,7 +18,7 @@ func Test_New(t *testing.T) {
 	assert.IsType(t, &batch{}, testBatch)
 
 	batchStruct, _ := testBatch.(*batch)
-	assert.Equal(t, options.BufferSize, uint64(batchStruct.buffer.Cap()))
+	assert.Equal(t, options.BufferSize, uint64(cap(batchStruct.buffer)))
 }
 
 func Test_Write(t *testing.T) {
@@ -62,6 +64,30 @@ func Test_Write(t *testing.T) {
 	}
 }
 
+type testAppender string
+
+func (a testAppender) AppendLine(dst []byte) []byte {
+	return append(dst, a...)
+}
+
+func Test_Append(t *testing.T) {
+	testBatch := New(&Options{
+		EntriesLimit: 3,
+		BufferSize:   10,
+	})
+
+	assert.Nil(t, testBatch.Append(testAppender("1111")))
+	assert.Equal(t, ErrSizeExceeded, testBatch.Append(testAppender("2222")))
+	assert.Nil(t, testBatch.Append(testAppender("333")))
+	assert.Equal(t, ErrLimitExceeded, testBatch.Append(testAppender("4")))
+
+	reader := testBatch.Reader()
+	readerBuffer, err := ioutil.ReadAll(reader.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "1111\n333\n", string(readerBuffer))
+	assert.Equal(t, uint64(2), reader.Entries)
+}
+
 func Test_Reader(t *testing.T) {
 	testBatch := New(&Options{
 		EntriesLimit: 3,
@@ -89,4 +115,42 @@ func Test_Reader(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(len(buffer)), reader.Size)
 	assert.Equal(t, uint64(len(lines)), reader.Entries)
+	assert.Equal(t, uint64(len(lines)), testBatch.Entries())
+	assert.Equal(t, uint64(len(buffer)), testBatch.Size())
+
+	testBatch.Reset()
+	assert.Equal(t, uint64(0), testBatch.Entries())
+	assert.Equal(t, uint64(0), testBatch.Size())
+}
+
+func Test_Write_CompressedSize(t *testing.T) {
+	testBatch := New(&Options{
+		EntriesLimit:   1000,
+		BufferSize:     1024,
+		CompressedSize: true,
+		GzipLevel:      gzip.BestCompression,
+	})
+
+	line := []byte(strings.Repeat("test", 64))
+	for i := 0; i < 100; i++ {
+		assert.Nilf(t, testBatch.Write(line), "%d", i)
+	}
+
+	reader := testBatch.Reader()
+	assert.Equal(t, uint64(100*(len(line)+1)), reader.Size)
+	assert.Equal(t, uint64(100), reader.Entries)
+
+	testBatch.Reset()
+
+	batchStruct, _ := testBatch.(*batch)
+	assert.Equal(t, uint64(0), batchStruct.compressed.n)
+	assert.Equal(t, ErrSizeExceeded, testBatch.Write([]byte(strings.Repeat("t", 1024))))
+
+	testBatch = New(&Options{
+		CompressedSize: true,
+		GzipLevel:      100,
+	})
+
+	batchStruct, _ = testBatch.(*batch)
+	assert.NotNil(t, batchStruct.gzip)
 }
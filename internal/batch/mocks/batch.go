@@ -12,6 +12,34 @@ type Batch struct {
 	mock.Mock
 }
 
+// Append provides a mock function with given fields: a
+func (_m *Batch) Append(a batch.Appender) error {
+	ret := _m.Called(a)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(batch.Appender) error); ok {
+		r0 = rf(a)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Entries provides a mock function with given fields:
+func (_m *Batch) Entries() uint64 {
+	ret := _m.Called()
+
+	var r0 uint64
+	if rf, ok := ret.Get(0).(func() uint64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	return r0
+}
+
 // Reader provides a mock function with given fields:
 func (_m *Batch) Reader() *batch.BatchReader {
 	ret := _m.Called()
@@ -33,6 +61,20 @@ func (_m *Batch) Reset() {
 	_m.Called()
 }
 
+// Size provides a mock function with given fields:
+func (_m *Batch) Size() uint64 {
+	ret := _m.Called()
+
+	var r0 uint64
+	if rf, ok := ret.Get(0).(func() uint64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	return r0
+}
+
 // Write provides a mock function with given fields: e
 func (_m *Batch) Write(e []byte) error {
 	ret := _m.Called(e)
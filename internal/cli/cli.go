@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+)
+
+// EnvPrefix is prepended to the upper-cased flag name, with dashes replaced
+// by underscores, to get the environment variable of a flag.
+const EnvPrefix = "INFLUX_"
+
+// Flags binds the writer options shared by the command line tools.
+type Flags struct {
+	serverURL             string
+	authToken             string
+	org                   string
+	orgID                 string
+	bucket                string
+	apiVersion            string
+	database              string
+	retentionPolicy       string
+	consistency           string
+	username              string
+	password              string
+	basicAuth             bool
+	precision             string
+	httpTimeout           time.Duration
+	gzip                  bool
+	gzipLevel             int
+	compressedBatchSize   bool
+	batchSize             uint64
+	entriesLimit          uint64
+	sendInterval          time.Duration
+	sendTimeout           time.Duration
+	maxInFlight           uint
+	concurrency           uint
+	validateLines         bool
+	inputQueueSize        uint
+	overflowPolicy        string
+	spillDir              string
+	spillMaxSize          uint64
+	retryAttempts         uint
+	retryInitialBackoff   time.Duration
+	retryMaxBackoff       time.Duration
+	retryJitter           float64
+	retryMaxElapsedTime   time.Duration
+	queueDir              string
+	queueMaxSize          uint64
+	deadLetterDir         string
+	deadLetterMaxFileSize int64
+	deadLetterMaxFiles    int
+	logLevel              string
+	quiet                 bool
+}
+
+func NewFlags(fs *flag.FlagSet) *Flags {
+	defaults := writer.DefaultOptions()
+
+	f := &Flags{}
+
+	fs.StringVar(&f.serverURL, "url", defaults.Client.ServerURL, "server url")
+	fs.StringVar(&f.authToken, "token", defaults.Client.AuthToken, "auth token")
+	fs.StringVar(&f.org, "org", defaults.Client.Org, "organization name")
+	fs.StringVar(&f.orgID, "org-id", defaults.Client.OrgID, "organization id")
+	fs.StringVar(&f.bucket, "bucket", defaults.Client.Bucket, "bucket")
+	fs.StringVar(&f.apiVersion, "api-version", defaults.Client.APIVersion, "api version: v1 or v2")
+	fs.StringVar(&f.database, "database", defaults.Client.Database, "database (v1)")
+	fs.StringVar(&f.retentionPolicy, "retention-policy", defaults.Client.RetentionPolicy, "retention policy (v1)")
+	fs.StringVar(&f.consistency, "consistency", defaults.Client.Consistency, "write consistency (v1)")
+	fs.StringVar(&f.username, "username", defaults.Client.Username, "username (v1)")
+	fs.StringVar(&f.password, "password", defaults.Client.Password, "password (v1)")
+	fs.BoolVar(&f.basicAuth, "basic-auth", defaults.Client.BasicAuth, "send username and password with basic auth (v1)")
+	fs.StringVar(&f.precision, "precision", defaults.Client.Precision, "timestamp precision: ns, us, ms or s")
+	fs.DurationVar(&f.httpTimeout, "http-timeout", defaults.Client.HTTPTimeout, "http timeout")
+	fs.BoolVar(&f.gzip, "gzip", defaults.Client.Gzip, "gzip request bodies")
+	fs.IntVar(&f.gzipLevel, "gzip-level", defaults.Client.GzipLevel, "gzip compression level")
+	fs.BoolVar(&f.compressedBatchSize, "compressed-batch-size", defaults.Batch.CompressedSize, "apply the batch size to the compressed size")
+	fs.Uint64Var(&f.batchSize, "batch-size", defaults.Batch.BufferSize, "batch size in bytes")
+	fs.Uint64Var(&f.entriesLimit, "entries-limit", defaults.Batch.EntriesLimit, "entries per batch")
+	fs.DurationVar(&f.sendInterval, "send-interval", defaults.Writer.SendInterval, "send interval")
+	fs.DurationVar(&f.sendTimeout, "send-timeout", defaults.Writer.SendTimeout, "send timeout")
+	fs.UintVar(&f.maxInFlight, "max-in-flight", defaults.Writer.MaxInFlight, "full batches waiting to be sent")
+	fs.UintVar(&f.concurrency, "concurrency", defaults.Writer.Concurrency, "batches sent in parallel")
+	fs.BoolVar(&f.validateLines, "validate", defaults.Writer.ValidateLines, "validate lines before writing")
+	fs.UintVar(&f.inputQueueSize, "input-queue-size", defaults.Writer.InputQueueSize, "lines waiting to be batched")
+	fs.StringVar(&f.overflowPolicy, "overflow-policy", defaults.Writer.OverflowPolicy.String(), "overflow policy: block, drop-newest, drop-oldest or spill")
+	fs.StringVar(&f.spillDir, "spill-dir", defaults.Writer.SpillDir, "spill directory")
+	fs.Uint64Var(&f.spillMaxSize, "spill-max-size", defaults.Writer.SpillMaxSize, "spill file size in bytes")
+	fs.UintVar(&f.retryAttempts, "retry-attempts", defaults.Retry.MaxAttempts, "attempts per batch")
+	fs.DurationVar(&f.retryInitialBackoff, "retry-initial-backoff", defaults.Retry.InitialBackoff, "delay before the first retry")
+	fs.DurationVar(&f.retryMaxBackoff, "retry-max-backoff", defaults.Retry.MaxBackoff, "maximum delay between retries")
+	fs.Float64Var(&f.retryJitter, "retry-jitter", defaults.Retry.Jitter, "random factor of retry delays")
+	fs.DurationVar(&f.retryMaxElapsedTime, "retry-max-elapsed-time", defaults.Retry.MaxElapsedTime, "time budget for retrying a batch")
+	fs.StringVar(&f.queueDir, "queue-dir", defaults.Queue.Dir, "durable queue directory")
+	fs.Uint64Var(&f.queueMaxSize, "queue-max-size", defaults.Queue.MaxSize, "durable queue size in bytes")
+	fs.StringVar(&f.deadLetterDir, "dead-letter-dir", "", "dead letter directory")
+	fs.Int64Var(&f.deadLetterMaxFileSize, "dead-letter-max-file-size", 64*1024*1024, "dead letter file size in bytes")
+	fs.IntVar(&f.deadLetterMaxFiles, "dead-letter-max-files", 10, "dead letter files to keep")
+	fs.StringVar(&f.logLevel, "log-level", defaults.LogLevel.String(), "log level: debug, info, warn or error")
+	fs.BoolVar(&f.quiet, "quiet", false, "log errors only")
+
+	return f
+}
+
+// Parse sets flags from their environment variables and then parses args,
+// so that command line flags take precedence.
+func Parse(fs *flag.FlagSet, args []string) error {
+	var err error
+
+	fs.VisitAll(func(fl *flag.Flag) {
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(fl.Name, "-", "_"))
+
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+
+		if setErr := fs.Set(fl.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", name, setErr)
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return fs.Parse(args)
+}
+
+func (f *Flags) Options() (*writer.Options, error) {
+	logLevel, err := writer.ParseLevel(f.logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.quiet {
+		logLevel = writer.LevelError
+	}
+
+	overflowPolicy, err := writer.ParseOverflowPolicy(f.overflowPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	options := writer.DefaultOptions().
+		SetServerURL(f.serverURL).
+		SetAuthToken(f.authToken).
+		SetOrg(f.org).
+		SetOrgID(f.orgID).
+		SetBucket(f.bucket).
+		SetAPIVersion(f.apiVersion).
+		SetDatabase(f.database).
+		SetRetentionPolicy(f.retentionPolicy).
+		SetConsistency(f.consistency).
+		SetUsername(f.username).
+		SetPassword(f.password).
+		SetBasicAuth(f.basicAuth).
+		SetPrecision(f.precision).
+		SetHTTPTimeout(f.httpTimeout).
+		SetGzip(f.gzip).
+		SetGzipLevel(f.gzipLevel).
+		SetCompressedBatchSize(f.compressedBatchSize).
+		SetBatchSize(f.batchSize).
+		SetEntriesLimit(f.entriesLimit).
+		SetSendInterval(f.sendInterval).
+		SetSendTimeout(f.sendTimeout).
+		SetMaxInFlight(f.maxInFlight).
+		SetConcurrency(f.concurrency).
+		SetValidateLines(f.validateLines).
+		SetInputQueueSize(f.inputQueueSize).
+		SetOverflowPolicy(overflowPolicy).
+		SetSpillDir(f.spillDir).
+		SetSpillMaxSize(f.spillMaxSize).
+		SetRetryMaxAttempts(f.retryAttempts).
+		SetRetryInitialBackoff(f.retryInitialBackoff).
+		SetRetryMaxBackoff(f.retryMaxBackoff).
+		SetRetryJitter(f.retryJitter).
+		SetRetryMaxElapsedTime(f.retryMaxElapsedTime).
+		SetQueueDir(f.queueDir).
+		SetQueueMaxSize(f.queueMaxSize).
+		SetLogLevel(logLevel)
+
+	if len(f.deadLetterDir) > 0 {
+		deadLetter, err := writer.NewFileDeadLetter(f.deadLetterDir,
+			f.deadLetterMaxFileSize, f.deadLetterMaxFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		options.SetDeadLetter(deadLetter)
+	}
+
+	// The org is not required, as with the writer itself, so that the tools
+	// work with the InfluxDB 1.8+ compatibility API.
+	if err := options.Validate(); err != nil && !errors.Is(err, writer.ErrOrgRequired) {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// Open returns a reader of the file content, decompressed if the file is
+// gzip-compressed.
+func Open(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+
+	magic, err := reader.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(reader)
+	}
+
+	return reader, nil
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Flags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := NewFlags(fs)
+
+	assert.Nil(t, fs.Parse([]string{"-org", "org"}))
+	options, err := flags.Options()
+	assert.Nil(t, err)
+	assert.Equal(t, writer.DefaultOptions().SetOrg("org").Client, options.Client)
+	assert.Equal(t, writer.DefaultOptions().Batch, options.Batch)
+	assert.Equal(t, writer.DefaultOptions().Writer, options.Writer)
+	assert.Equal(t, writer.DefaultOptions().Retry, options.Retry)
+	assert.Equal(t, writer.DefaultOptions().Queue, options.Queue)
+
+	assert.Nil(t, fs.Parse([]string{
+		"-url", "http://influx:8086",
+		"-token", "token",
+		"-org", "org",
+		"-bucket", "bucket",
+		"-precision", "s",
+		"-http-timeout", "1s",
+		"-gzip",
+		"-batch-size", "1024",
+		"-entries-limit", "10",
+		"-retry-attempts", "2",
+	}))
+
+	options, err = flags.Options()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://influx:8086", options.Client.ServerURL)
+	assert.Equal(t, "token", options.Client.AuthToken)
+	assert.Equal(t, "org", options.Client.Org)
+	assert.Equal(t, "bucket", options.Client.Bucket)
+	assert.Equal(t, "s", options.Client.Precision)
+	assert.Equal(t, time.Second, options.Client.HTTPTimeout)
+	assert.True(t, options.Client.Gzip)
+	assert.Equal(t, uint64(1024), options.Batch.BufferSize)
+	assert.Equal(t, uint64(10), options.Batch.EntriesLimit)
+	assert.Equal(t, uint(2), options.Retry.MaxAttempts)
+}
+
+func Test_Parse(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := NewFlags(fs)
+
+	t.Setenv("INFLUX_BUCKET", "env-bucket")
+	t.Setenv("INFLUX_ORG_ID", "env-org")
+	t.Setenv("INFLUX_RETRY_JITTER", "0.5")
+
+	assert.Nil(t, Parse(fs, []string{"-bucket", "flag-bucket", "-quiet"}))
+
+	options, err := flags.Options()
+	assert.Nil(t, err)
+	assert.Equal(t, "flag-bucket", options.Client.Bucket)
+	assert.Equal(t, "env-org", options.Client.OrgID)
+	assert.Equal(t, 0.5, options.Retry.Jitter)
+	assert.Equal(t, writer.LevelError, options.LogLevel)
+	assert.Nil(t, options.DeadLetter)
+
+	t.Setenv("INFLUX_CONCURRENCY", "many")
+
+	assert.EqualError(t, Parse(fs, nil),
+		`INFLUX_CONCURRENCY: parse error`)
+}
+
+func Test_Options_Org(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := NewFlags(fs)
+
+	assert.Nil(t, fs.Parse(nil))
+	options, err := flags.Options()
+	assert.Nil(t, err)
+	assert.Empty(t, options.Client.Org)
+
+	assert.Nil(t, fs.Parse([]string{"-bucket", ""}))
+	_, err = flags.Options()
+	assert.ErrorIs(t, err, writer.ErrBucketRequired)
+}
+
+func Test_Options(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := NewFlags(fs)
+
+	dir := t.TempDir()
+
+	assert.Nil(t, fs.Parse([]string{"-org", "org", "-dead-letter-dir", dir}))
+
+	options, err := flags.Options()
+	assert.Nil(t, err)
+	assert.NotNil(t, options.DeadLetter)
+
+	assert.Nil(t, fs.Parse([]string{"-log-level", "trace"}))
+
+	_, err = flags.Options()
+	assert.EqualError(t, err, "unknown log level: trace")
+
+	assert.Nil(t, fs.Parse([]string{"-log-level", "debug", "-overflow-policy", "test"}))
+
+	_, err = flags.Options()
+	assert.EqualError(t, err, "unknown overflow policy: test")
+
+	assert.Nil(t, fs.Parse([]string{"-overflow-policy", "spill"}))
+
+	_, err = flags.Options()
+	assert.ErrorIs(t, err, writer.ErrSpillDirRequired)
+
+	assert.Nil(t, fs.Parse([]string{"-overflow-policy", "drop-oldest", "-bucket", ""}))
+
+	_, err = flags.Options()
+	assert.ErrorIs(t, err, writer.ErrBucketRequired)
+}
+
+func Test_Open(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, _ = gz.Write([]byte("cpu v=1\n"))
+	_ = gz.Close()
+
+	for _, input := range []io.Reader{buf, strings.NewReader("cpu v=1\n")} {
+		reader, err := Open(input)
+		assert.Nil(t, err)
+
+		data, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, "cpu v=1\n", string(data))
+	}
+
+	reader, err := Open(strings.NewReader(""))
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Empty(t, data)
+}
@@ -4,12 +4,18 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -18,49 +24,140 @@ type httpClient interface {
 	Do(r *http.Request) (*http.Response, error)
 }
 
+type LineError struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
 type ClientResponse struct {
 	RequestID     string
 	StatusCode    int
 	Response      string
 	ResponseError string
+	RetryAfter    time.Duration
+	LineErrors    []LineError
+	// Partial is set when the server stored the valid points of the batch
+	// and rejected the others.
+	Partial bool
 }
 
 type Client interface {
 	Send(ctx context.Context, reader io.Reader) (*ClientResponse, error)
 }
 
+const (
+	APIv1 = "v1"
+	APIv2 = "v2"
+)
+
 type Options struct {
-	ServerURL   string
-	AuthToken   string
-	Bucket      string
-	Precision   string
-	HTTPTimeout time.Duration
+	APIVersion      string
+	ServerURL       string
+	AuthToken       string
+	Org             string
+	OrgID           string
+	Bucket          string
+	Database        string
+	RetentionPolicy string
+	Consistency     string
+	Username        string
+	Password        string
+	BasicAuth       bool
+	Precision       string
+	HTTPTimeout     time.Duration
+	Gzip            bool
+	GzipLevel       int
+	InjectHeaders   func(ctx context.Context, header http.Header)
+	// HTTPClient is shared by clients of the same server, HTTPTimeout is
+	// ignored when it is set.
+	HTTPClient *http.Client
+}
+
+var (
+	ErrBucketRequired   = errors.New("bucket is required")
+	ErrOrgRequired      = errors.New("org or org id is required")
+	ErrDatabaseRequired = errors.New("database is required")
+)
+
+func (o *Options) Validate() error {
+	switch o.APIVersion {
+	case APIv1:
+		if len(o.Database) == 0 {
+			return ErrDatabaseRequired
+		}
+	case "", APIv2:
+		if len(o.Bucket) == 0 {
+			return ErrBucketRequired
+		}
+
+		if len(o.Org) == 0 && len(o.OrgID) == 0 {
+			return ErrOrgRequired
+		}
+	default:
+		return fmt.Errorf("unknown api version: %s", o.APIVersion)
+	}
+
+	return nil
 }
 
 type client struct {
-	http  httpClient
-	url   string
-	token string
+	http      httpClient
+	url       string
+	token     string
+	username  string
+	password  string
+	basicAuth bool
+	gzip      bool
+	gzipLevel int
+	inject    func(ctx context.Context, header http.Header)
 }
 
 func New(options *Options) Client {
 	c := &client{
-		http: &http.Client{
+		http: options.HTTPClient,
+	}
+
+	if options.HTTPClient == nil {
+		c.http = &http.Client{
 			Timeout: options.HTTPTimeout,
-		},
+		}
 	}
 
 	c.url = makeURL(options)
 	c.token = options.AuthToken
 
+	if options.APIVersion == APIv1 {
+		c.username = options.Username
+		c.password = options.Password
+		c.basicAuth = options.BasicAuth
+	}
+	c.gzip = options.Gzip
+	c.gzipLevel = options.GzipLevel
+	c.inject = options.InjectHeaders
+
 	return c
 }
 
 func makeURL(options *Options) string {
+	if options.APIVersion == APIv1 {
+		return makeURLv1(options)
+	}
+
 	params := url.Values{}
 
 	changed := false
 
+	if len(options.Org) > 0 {
+		params.Add("org", options.Org)
+		changed = true
+	}
+
+	if len(options.OrgID) > 0 {
+		params.Add("orgID", options.OrgID)
+		changed = true
+	}
+
 	if len(options.Bucket) > 0 {
 		params.Add("bucket", options.Bucket)
 		changed = true
@@ -80,20 +177,104 @@ func makeURL(options *Options) string {
 	return url
 }
 
+var precisionV1 = map[string]string{
+	"ns": "n",
+	"us": "u",
+}
+
+func makeURLv1(options *Options) string {
+	params := url.Values{}
+
+	if len(options.Database) > 0 {
+		params.Add("db", options.Database)
+	}
+
+	if len(options.RetentionPolicy) > 0 {
+		params.Add("rp", options.RetentionPolicy)
+	}
+
+	if len(options.Precision) > 0 {
+		precision, ok := precisionV1[options.Precision]
+		if !ok {
+			precision = options.Precision
+		}
+
+		params.Add("precision", precision)
+	}
+
+	if len(options.Consistency) > 0 {
+		params.Add("consistency", options.Consistency)
+	}
+
+	if len(options.Username) > 0 && !options.BasicAuth {
+		params.Add("u", options.Username)
+		params.Add("p", options.Password)
+	}
+
+	url := options.ServerURL + "/write"
+
+	if len(params) > 0 {
+		url += "?" + params.Encode()
+	}
+
+	return url
+}
+
+func (c *client) compress(reader io.Reader) (io.Reader, error) {
+	buffer := &bytes.Buffer{}
+
+	gz, err := gzip.NewWriterLevel(buffer, c.gzipLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(gz, reader); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
 func (c *client) makeRequest(ctx context.Context, reader io.Reader) (*http.Request, error) {
+	if c.gzip && reader != nil {
+		compressed, err := c.compress(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = compressed
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "POST", c.url, reader)
 	if err != nil {
-		return nil, err
+		return nil, redactURL(err)
+	}
+
+	if c.basicAuth {
+		req.SetBasicAuth(c.username, c.password)
+	} else if len(c.username) == 0 {
+		req.Header.Add("Authorization", "Token "+c.token)
 	}
 
-	req.Header.Add("Authorization", "Token "+c.token)
 	req.Header.Add("User-Agent", "go-influxdb-writer")
 
+	if c.gzip {
+		req.Header.Add("Content-Encoding", "gzip")
+	}
+
+	if c.inject != nil {
+		c.inject(ctx, req.Header)
+	}
+
 	return req, nil
 }
 
 func (c *client) makeResponse(resp *http.Response) (*ClientResponse, error) {
-	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
 	if err != nil {
 		return nil, err
 	}
@@ -102,21 +283,89 @@ func (c *client) makeResponse(resp *http.Response) (*ClientResponse, error) {
 	clientResp := &ClientResponse{
 		RequestID:  resp.Header.Get("X-Request-Id"),
 		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
 	}
 
 	if resp.StatusCode != 204 {
-		respErr := map[string]string{"error": ""}
+		respErr := struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}{}
 
 		if err := json.Unmarshal(body, &respErr); err != nil {
 			clientResp.Response = strings.ReplaceAll(string(body), "\n", " ")
 		} else {
-			clientResp.ResponseError = strings.ReplaceAll(respErr["error"], "\n", " ")
+			if len(respErr.Error) == 0 {
+				respErr.Error = respErr.Message
+			}
+
+			clientResp.ResponseError = strings.ReplaceAll(respErr.Error, "\n", " ")
+			clientResp.LineErrors = parseLineErrors(respErr.Error)
+			clientResp.Partial = strings.Contains(respErr.Error, "partial write")
 		}
 	}
 
 	return clientResp, nil
 }
 
+const maxResponseSize = 16 * 1024
+
+var (
+	lineNumberRegexp = regexp.MustCompile(`(?i)line (\d+)(?: \(1-based\))?: (.+)`)
+	lineTextRegexp   = regexp.MustCompile(`unable to parse '(.*)': (.+?)(?: dropped=\d+)?$`)
+	// credentialsRegexp matches the v1 credentials in the query string, it
+	// does not parse the url, which may be malformed.
+	credentialsRegexp = regexp.MustCompile(`([?&][up]=)[^&#]*`)
+)
+
+func parseLineErrors(message string) []LineError {
+	var lineErrors []LineError
+
+	for _, part := range strings.Split(message, "\n") {
+		if match := lineNumberRegexp.FindStringSubmatch(part); match != nil {
+			line, err := strconv.Atoi(match[1])
+			if err == nil && line > 0 {
+				lineErrors = append(lineErrors, LineError{
+					Line:   line,
+					Reason: match[2],
+				})
+			}
+
+			continue
+		}
+
+		if match := lineTextRegexp.FindStringSubmatch(part); match != nil {
+			lineErrors = append(lineErrors, LineError{
+				Text:   match[1],
+				Reason: match[2],
+			})
+		}
+	}
+
+	return lineErrors
+}
+
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
 func (c *client) Send(ctx context.Context, reader io.Reader) (*ClientResponse, error) {
 	req, err := c.makeRequest(ctx, reader)
 	if err != nil {
@@ -125,8 +374,23 @@ func (c *client) Send(ctx context.Context, reader io.Reader) (*ClientResponse, e
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, redactURL(err)
 	}
 
 	return c.makeResponse(resp)
 }
+
+// redactURL hides the v1 credentials, which are sent in the query string,
+// in url errors, so that they don't end up in logs and error reports.
+func redactURL(err error) error {
+	urlErr, ok := err.(*url.Error)
+	if !ok || !credentialsRegexp.MatchString(urlErr.URL) {
+		return err
+	}
+
+	return &url.Error{
+		Op:  urlErr.Op,
+		URL: credentialsRegexp.ReplaceAllString(urlErr.URL, "${1}xxxxx"),
+		Err: urlErr.Err,
+	}
+}
@@ -2,11 +2,14 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,6 +18,10 @@ import (
 func Test_New(t *testing.T) {
 	testClient := New(&Options{})
 	assert.IsType(t, &client{}, testClient)
+
+	httpClient := &http.Client{}
+	testClient = New(&Options{HTTPClient: httpClient})
+	assert.Same(t, httpClient, testClient.(*client).http)
 }
 
 func Test_makeURL(t *testing.T) {
@@ -44,6 +51,46 @@ func Test_makeURL(t *testing.T) {
 			},
 			url: "/api/v2/write?precision=test",
 		},
+		{
+			options: &Options{
+				Org:       "org",
+				OrgID:     "id",
+				Bucket:    "test",
+				Precision: "s",
+			},
+			url: "/api/v2/write?bucket=test&org=org&orgID=id&precision=s",
+		},
+		{
+			options: &Options{
+				APIVersion: APIv1,
+				ServerURL:  "test",
+			},
+			url: "test/write",
+		},
+		{
+			options: &Options{
+				APIVersion:      APIv1,
+				Bucket:          "bucket",
+				Database:        "db",
+				RetentionPolicy: "rp",
+				Precision:       "ns",
+				Consistency:     "all",
+				Username:        "user",
+				Password:        "password",
+			},
+			url: "/write?consistency=all&db=db&p=password&precision=n&rp=rp&u=user",
+		},
+		{
+			options: &Options{
+				APIVersion: APIv1,
+				Database:   "db",
+				Precision:  "ms",
+				Username:   "user",
+				Password:   "password",
+				BasicAuth:  true,
+			},
+			url: "/write?db=db&precision=ms",
+		},
 	}
 
 	for tt, table := range tables {
@@ -52,6 +99,60 @@ func Test_makeURL(t *testing.T) {
 	}
 }
 
+func Test_Validate(t *testing.T) {
+	tables := []struct {
+		options *Options
+		err     error
+	}{
+		{
+			options: &Options{},
+			err:     ErrBucketRequired,
+		},
+		{
+			options: &Options{
+				APIVersion: APIv2,
+				Bucket:     "test",
+			},
+			err: ErrOrgRequired,
+		},
+		{
+			options: &Options{
+				Bucket: "test",
+				Org:    "test",
+			},
+			err: nil,
+		},
+		{
+			options: &Options{
+				APIVersion: APIv2,
+				Bucket:     "test",
+				OrgID:      "test",
+			},
+			err: nil,
+		},
+		{
+			options: &Options{
+				APIVersion: APIv1,
+				Bucket:     "test",
+			},
+			err: ErrDatabaseRequired,
+		},
+		{
+			options: &Options{
+				APIVersion: APIv1,
+				Database:   "test",
+			},
+			err: nil,
+		},
+	}
+
+	for tt, table := range tables {
+		assert.Equalf(t, table.err, table.options.Validate(), "%d", tt)
+	}
+
+	assert.EqualError(t, (&Options{APIVersion: "test"}).Validate(), "unknown api version: test")
+}
+
 func Test_makeRequest(t *testing.T) {
 	testClient := &client{}
 
@@ -62,6 +163,76 @@ func Test_makeRequest(t *testing.T) {
 	request, err = testClient.makeRequest(context.Background(), nil)
 	assert.IsType(t, &http.Request{}, request)
 	assert.Nil(t, err)
+	assert.Equal(t, "", request.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Token ", request.Header.Get("Authorization"))
+
+	testClient = New(&Options{
+		APIVersion: APIv1,
+		Username:   "user",
+		Password:   "password",
+		BasicAuth:  true,
+	}).(*client)
+
+	request, err = testClient.makeRequest(context.Background(), nil)
+	assert.Nil(t, err)
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "password", password)
+
+	testClient.basicAuth = false
+
+	request, err = testClient.makeRequest(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", request.Header.Get("Authorization"))
+
+	testClient = New(&Options{
+		InjectHeaders: func(ctx context.Context, header http.Header) {
+			header.Set("Traceparent", "00-trace-span-01")
+		},
+	}).(*client)
+
+	request, err = testClient.makeRequest(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "00-trace-span-01", request.Header.Get("Traceparent"))
+
+	testClient = &client{
+		gzip:      true,
+		gzipLevel: gzip.BestSpeed,
+	}
+
+	request, err = testClient.makeRequest(context.Background(), bytes.NewBufferString("test\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "gzip", request.Header.Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(request.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+	assert.Equal(t, "test\n", string(body))
+
+	testClient.gzipLevel = 100
+	request, err = testClient.makeRequest(context.Background(), bytes.NewBufferString("test\n"))
+	assert.Nil(t, request)
+	assert.EqualError(t, err, "gzip: invalid compression level: 100")
+
+	testClient.gzipLevel = gzip.BestSpeed
+	request, err = testClient.makeRequest(context.Background(), &errReader{})
+	assert.Nil(t, request)
+	assert.EqualError(t, err, "test")
+
+	testClient = New(&Options{
+		APIVersion: APIv1,
+		ServerURL:  "http://local host:8086",
+		Database:   "db",
+		Username:   "user",
+		Password:   "secret",
+	}).(*client)
+
+	request, err = testClient.makeRequest(context.Background(), nil)
+	assert.Nil(t, request)
+	assert.EqualError(t, err,
+		`parse "http://local host:8086/write?db=db&p=xxxxx&u=xxxxx": invalid character " " in host name`)
 }
 
 type errReader struct{}
@@ -85,6 +256,7 @@ func Test_makeResponse(t *testing.T) {
 
 	tables := []struct {
 		statusCode     int
+		header         http.Header
 		responseBody   []byte
 		clientResponse *ClientResponse
 	}{
@@ -111,11 +283,49 @@ func Test_makeResponse(t *testing.T) {
 				ResponseError: "test",
 			},
 		},
+		{
+			statusCode:   400,
+			responseBody: []byte(`{"code":"invalid","message":"failed to parse line protocol:\nerrors encountered on line(s):\nline 2: missing fields"}`),
+			clientResponse: &ClientResponse{
+				StatusCode:    400,
+				ResponseError: "failed to parse line protocol: errors encountered on line(s): line 2: missing fields",
+				LineErrors: []LineError{
+					{Line: 2, Reason: "missing fields"},
+				},
+			},
+		},
+		{
+			statusCode:   400,
+			responseBody: []byte(`{"error":"partial write: unable to parse 'cpu': missing fields dropped=1"}`),
+			clientResponse: &ClientResponse{
+				StatusCode:    400,
+				ResponseError: "partial write: unable to parse 'cpu': missing fields dropped=1",
+				LineErrors: []LineError{
+					{Text: "cpu", Reason: "missing fields"},
+				},
+				Partial: true,
+			},
+		},
+		{
+			statusCode: 429,
+			header: http.Header{
+				"X-Request-Id": []string{"id"},
+				"Retry-After":  []string{"30"},
+			},
+			responseBody: []byte(`{"error":"test"}`),
+			clientResponse: &ClientResponse{
+				RequestID:     "id",
+				StatusCode:    429,
+				ResponseError: "test",
+				RetryAfter:    30 * time.Second,
+			},
+		},
 	}
 
 	for tt, table := range tables {
 		response := &http.Response{
 			StatusCode: table.statusCode,
+			Header:     table.header,
 			Body:       ioutil.NopCloser(bytes.NewBuffer(table.responseBody)),
 		}
 
@@ -125,6 +335,81 @@ func Test_makeResponse(t *testing.T) {
 	}
 }
 
+func Test_parseLineErrors(t *testing.T) {
+	tables := []struct {
+		message    string
+		lineErrors []LineError
+	}{
+		{
+			message:    "test",
+			lineErrors: nil,
+		},
+		{
+			message: "partial write: unable to parse 'cpu value=': missing field value\nunable to parse 'cpu,host=a': missing fields dropped=0",
+			lineErrors: []LineError{
+				{Text: "cpu value=", Reason: "missing field value"},
+				{Text: "cpu,host=a", Reason: "missing fields"},
+			},
+		},
+		{
+			message: "failed to parse line protocol:\nerrors encountered on line(s):\nline 1: missing fields\nline 3: invalid field format",
+			lineErrors: []LineError{
+				{Line: 1, Reason: "missing fields"},
+				{Line: 3, Reason: "invalid field format"},
+			},
+		},
+		{
+			message: "error parsing line 7 (1-based): Invalid measurement",
+			lineErrors: []LineError{
+				{Line: 7, Reason: "Invalid measurement"},
+			},
+		},
+	}
+
+	for tt, table := range tables {
+		assert.Equalf(t, table.lineErrors, parseLineErrors(table.message), "%d", tt)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tables := []struct {
+		value      string
+		retryAfter time.Duration
+	}{
+		{
+			value:      "",
+			retryAfter: 0,
+		},
+		{
+			value:      "120",
+			retryAfter: 2 * time.Minute,
+		},
+		{
+			value:      "-1",
+			retryAfter: 0,
+		},
+		{
+			value:      "Fri, 01 Jan 2021 00:00:30 GMT",
+			retryAfter: 30 * time.Second,
+		},
+		{
+			value:      "Thu, 31 Dec 2020 23:59:00 GMT",
+			retryAfter: 0,
+		},
+		{
+			value:      "test",
+			retryAfter: 0,
+		},
+	}
+
+	for tt, table := range tables {
+		retryAfter := parseRetryAfter(table.value, now)
+		assert.Equalf(t, table.retryAfter, retryAfter, "%d", tt)
+	}
+}
+
 func Test_Send(t *testing.T) {
 	testClient := &client{}
 
@@ -139,6 +424,18 @@ func Test_Send(t *testing.T) {
 	assert.Nil(t, clientResponse)
 	assert.EqualError(t, err, "test")
 
+	testHTTPClient = &mockHTTPClient{}
+	testHTTPClient.On("Do", mock.Anything, mock.Anything).Return(nil, &url.Error{
+		Op:  "Post",
+		URL: "http://localhost:8086/write?db=db&p=secret&u=user",
+		Err: errors.New("test"),
+	})
+	testClient.http = testHTTPClient
+	clientResponse, err = testClient.Send(context.Background(), nil)
+	assert.Nil(t, clientResponse)
+	assert.EqualError(t, err, `Post "http://localhost:8086/write?db=db&p=xxxxx&u=xxxxx": test`)
+	assert.Equal(t, "test", errors.Unwrap(err).Error())
+
 	testHTTPClient = &mockHTTPClient{}
 	testHTTPClient.On("Do", mock.Anything, mock.Anything).Return(&http.Response{
 		Body: &errReader{},
@@ -0,0 +1,223 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrInvalid = errors.New("invalid line protocol")
+
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at %d: %s", ErrInvalid, e.Pos, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return ErrInvalid
+}
+
+func newError(pos int, msg string) error {
+	return &Error{Pos: pos, Msg: msg}
+}
+
+func Validate(line []byte) error {
+	for i, c := range line {
+		if c == '\n' {
+			return newError(i, "line contains newline")
+		}
+	}
+
+	if len(line) == 0 {
+		return newError(0, "empty line")
+	}
+
+	pos := scan(line, 0, ',', ' ', 0)
+	if pos == 0 {
+		return newError(pos, "missing measurement")
+	}
+
+	for pos < len(line) && line[pos] == ',' {
+		start := pos + 1
+
+		pos = scan(line, start, '=', ',', ' ')
+		if pos == start {
+			return newError(pos, "missing tag key")
+		}
+
+		if pos == len(line) || line[pos] != '=' {
+			return newError(pos, "missing tag value")
+		}
+
+		start = pos + 1
+
+		pos = scan(line, start, ',', ' ', '=')
+		if pos == start {
+			return newError(pos, "missing tag value")
+		}
+
+		if pos < len(line) && line[pos] == '=' {
+			return newError(pos, "unescaped '=' in tag value")
+		}
+	}
+
+	if pos == len(line) {
+		return newError(pos, "missing fields")
+	}
+
+	pos, err := scanFields(line, pos+1)
+	if err != nil {
+		return err
+	}
+
+	if pos == len(line) {
+		return nil
+	}
+
+	return validateTimestamp(line, pos+1)
+}
+
+// Measurement returns the unescaped measurement of the line.
+func Measurement(line []byte) string {
+	end := scan(line, 0, ',', ' ', 0)
+	if bytes.IndexByte(line[:end], '\\') < 0 {
+		return string(line[:end])
+	}
+
+	measurement := make([]byte, 0, end)
+
+	for i := 0; i < end; i++ {
+		if line[i] == '\\' && i+1 < end && (line[i+1] == ',' || line[i+1] == ' ') {
+			i++
+		}
+
+		measurement = append(measurement, line[i])
+	}
+
+	return string(measurement)
+}
+
+func scan(line []byte, pos int, stop1, stop2, stop3 byte) int {
+	for ; pos < len(line); pos++ {
+		c := line[pos]
+
+		if c == '\\' && pos+1 < len(line) {
+			pos++
+			continue
+		}
+
+		if c == stop1 || c == stop2 || (stop3 != 0 && c == stop3) {
+			break
+		}
+	}
+
+	return pos
+}
+
+func scanFields(line []byte, pos int) (int, error) {
+	for {
+		start := pos
+
+		pos = scan(line, start, '=', ',', ' ')
+		if pos == start {
+			return pos, newError(pos, "missing field key")
+		}
+
+		if pos == len(line) || line[pos] != '=' {
+			return pos, newError(pos, "missing field value")
+		}
+
+		pos++
+
+		if pos == len(line) || line[pos] == ',' || line[pos] == ' ' {
+			return pos, newError(pos, "missing field value")
+		}
+
+		if line[pos] == '"' {
+			end, err := scanString(line, pos)
+			if err != nil {
+				return end, err
+			}
+
+			pos = end
+		} else {
+			start = pos
+			pos = scan(line, start, ',', ' ', 0)
+
+			if !validValue(line[start:pos]) {
+				return start, newError(start, fmt.Sprintf("invalid field value '%s'", line[start:pos]))
+			}
+		}
+
+		if pos == len(line) || line[pos] == ' ' {
+			return pos, nil
+		}
+
+		if line[pos] != ',' {
+			return pos, newError(pos, "invalid field separator")
+		}
+
+		pos++
+	}
+}
+
+func scanString(line []byte, pos int) (int, error) {
+	for i := pos + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+
+	return pos, newError(pos, "unterminated string field value")
+}
+
+func validValue(value []byte) bool {
+	switch string(value) {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+
+	last := value[len(value)-1]
+
+	if last == 'i' {
+		_, err := strconv.ParseInt(string(value[:len(value)-1]), 10, 64)
+		return err == nil
+	}
+
+	if last == 'u' {
+		_, err := strconv.ParseUint(string(value[:len(value)-1]), 10, 64)
+		return err == nil
+	}
+
+	for _, c := range value {
+		if (c < '0' || c > '9') && c != '.' && c != '-' && c != '+' && c != 'e' && c != 'E' {
+			return false
+		}
+	}
+
+	_, err := strconv.ParseFloat(string(value), 64)
+
+	return err == nil
+}
+
+func validateTimestamp(line []byte, pos int) error {
+	value := line[pos:]
+
+	if len(value) == 0 {
+		return newError(pos, "missing timestamp")
+	}
+
+	if _, err := strconv.ParseInt(string(value), 10, 64); err != nil {
+		return newError(pos, fmt.Sprintf("invalid timestamp '%s'", value))
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package lineprotocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Validate(t *testing.T) {
+	tables := []struct {
+		line string
+		err  string
+	}{
+		{
+			line: "cpu value=1",
+		},
+		{
+			line: `cpu,host=server\ 01,region=us-west value=1i,count=2u,ok=true,load=-0.5e3,msg="a, b=\"c\"" 1600000000000000000`,
+		},
+		{
+			line: `my\ cpu\,1,tag\=key=tag\,value value=T -1`,
+		},
+		{
+			line: "",
+			err:  "invalid line protocol at 0: empty line",
+		},
+		{
+			line: "cpu value=1\ncpu value=2",
+			err:  "invalid line protocol at 11: line contains newline",
+		},
+		{
+			line: " value=1",
+			err:  "invalid line protocol at 0: missing measurement",
+		},
+		{
+			line: "cpu",
+			err:  "invalid line protocol at 3: missing fields",
+		},
+		{
+			line: "cpu,host=a",
+			err:  "invalid line protocol at 10: missing fields",
+		},
+		{
+			line: "cpu,=a value=1",
+			err:  "invalid line protocol at 4: missing tag key",
+		},
+		{
+			line: "cpu,host value=1",
+			err:  "invalid line protocol at 8: missing tag value",
+		},
+		{
+			line: "cpu,host= value=1",
+			err:  "invalid line protocol at 9: missing tag value",
+		},
+		{
+			line: "cpu,host=a=b value=1",
+			err:  "invalid line protocol at 10: unescaped '=' in tag value",
+		},
+		{
+			line: "cpu ",
+			err:  "invalid line protocol at 4: missing field key",
+		},
+		{
+			line: "cpu value",
+			err:  "invalid line protocol at 9: missing field value",
+		},
+		{
+			line: "cpu value=",
+			err:  "invalid line protocol at 10: missing field value",
+		},
+		{
+			line: "cpu value=1,",
+			err:  "invalid line protocol at 12: missing field key",
+		},
+		{
+			line: "cpu value=abc",
+			err:  "invalid line protocol at 10: invalid field value 'abc'",
+		},
+		{
+			line: "cpu value=1.5i",
+			err:  "invalid line protocol at 10: invalid field value '1.5i'",
+		},
+		{
+			line: "cpu value=-1u",
+			err:  "invalid line protocol at 10: invalid field value '-1u'",
+		},
+		{
+			line: `cpu value="test`,
+			err:  "invalid line protocol at 10: unterminated string field value",
+		},
+		{
+			line: `cpu value="test"x`,
+			err:  "invalid line protocol at 16: invalid field separator",
+		},
+		{
+			line: "cpu value=1 ",
+			err:  "invalid line protocol at 12: missing timestamp",
+		},
+		{
+			line: "cpu value=1 now",
+			err:  "invalid line protocol at 12: invalid timestamp 'now'",
+		},
+		{
+			line: "cpu value=1 1 2",
+			err:  "invalid line protocol at 12: invalid timestamp '1 2'",
+		},
+		{
+			line: "cpu a b=1",
+			err:  "invalid line protocol at 5: missing field value",
+		},
+	}
+
+	for tt, table := range tables {
+		err := Validate([]byte(table.line))
+		if len(table.err) == 0 {
+			assert.Nilf(t, err, "%d %s", tt, table.line)
+			continue
+		}
+
+		assert.EqualErrorf(t, err, table.err, "%d %s", tt, table.line)
+		assert.Truef(t, errors.Is(err, ErrInvalid), "%d", tt)
+	}
+}
+
+func Test_Measurement(t *testing.T) {
+	tables := []struct {
+		line        string
+		measurement string
+	}{
+		{line: "cpu value=1", measurement: "cpu"},
+		{line: "cpu,host=a value=1", measurement: "cpu"},
+		{line: `my\ cpu\,1,tag=a value=1`, measurement: "my cpu,1"},
+		{line: `c\pu value=1`, measurement: `c\pu`},
+		{line: "cpu", measurement: "cpu"},
+		{line: "", measurement: ""},
+	}
+
+	for tt, table := range tables {
+		assert.Equalf(t, table.measurement, Measurement([]byte(table.line)), "%d", tt)
+	}
+}
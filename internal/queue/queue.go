@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Queue interface {
+	Put(data []byte) (string, error)
+	Read(id string) ([]byte, error)
+	Remove(id string) error
+	Segments() []string
+}
+
+type Options struct {
+	Dir     string
+	MaxSize uint64
+}
+
+type queue struct {
+	lock     sync.Mutex
+	dir      string
+	maxSize  uint64
+	size     uint64
+	sequence uint64
+	segments map[string]uint64
+}
+
+const (
+	segmentExt = ".seg"
+	tempExt    = ".tmp"
+)
+
+var ErrQueueFull = errors.New("queue size exceeded")
+
+func New(options *Options) (Queue, error) {
+	q := &queue{
+		dir:      options.Dir,
+		maxSize:  options.MaxSize,
+		segments: make(map[string]uint64),
+	}
+
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+
+		if strings.HasSuffix(name, tempExt) {
+			_ = os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if sequence >= q.sequence {
+			q.sequence = sequence + 1
+		}
+
+		q.segments[name] = uint64(file.Size())
+		q.size += uint64(file.Size())
+	}
+
+	return q, nil
+}
+
+func (q *queue) Put(data []byte) (string, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.maxSize > 0 && q.size+uint64(len(data)) > q.maxSize {
+		return "", ErrQueueFull
+	}
+
+	id := fmt.Sprintf("%020d%s", q.sequence, segmentExt)
+	path := filepath.Join(q.dir, id)
+
+	if err := writeFile(path+tempExt, data); err != nil {
+		_ = os.Remove(path + tempExt)
+		return "", err
+	}
+
+	if err := os.Rename(path+tempExt, path); err != nil {
+		_ = os.Remove(path + tempExt)
+		return "", err
+	}
+
+	q.sequence++
+	q.segments[id] = uint64(len(data))
+	q.size += uint64(len(data))
+
+	return id, nil
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (q *queue) Read(id string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(q.dir, id))
+}
+
+func (q *queue) Remove(id string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := os.Remove(filepath.Join(q.dir, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	q.size -= q.segments[id]
+	delete(q.segments, id)
+
+	return nil
+}
+
+func (q *queue) Segments() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	segments := make([]string, 0, len(q.segments))
+	for id := range q.segments {
+		segments = append(segments, id)
+	}
+
+	sort.Strings(segments)
+
+	return segments
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "00000000000000000007.seg"), []byte("test\n"), 0o644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "00000000000000000008.seg.tmp"), []byte("test\n"), 0o644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte("test\n"), 0o644))
+
+	testQueue, err := New(&Options{Dir: dir})
+	assert.Nil(t, err)
+	assert.IsType(t, &queue{}, testQueue)
+
+	queueStruct, _ := testQueue.(*queue)
+	assert.Equal(t, uint64(8), queueStruct.sequence)
+	assert.Equal(t, uint64(5), queueStruct.size)
+	assert.Equal(t, []string{"00000000000000000007.seg"}, testQueue.Segments())
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000008.seg.tmp"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = New(&Options{Dir: filepath.Join(dir, "test.txt")})
+	assert.NotNil(t, err)
+}
+
+func Test_Put_Read_Remove(t *testing.T) {
+	testQueue, err := New(&Options{
+		Dir:     t.TempDir(),
+		MaxSize: 10,
+	})
+	assert.Nil(t, err)
+
+	id1, err := testQueue.Put([]byte("test1\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000000000000000.seg", id1)
+
+	id2, err := testQueue.Put([]byte("test2\n"))
+	assert.Equal(t, "", id2)
+	assert.Equal(t, ErrQueueFull, err)
+
+	data, err := testQueue.Read(id1)
+	assert.Nil(t, err)
+	assert.Equal(t, "test1\n", string(data))
+
+	assert.Nil(t, testQueue.Remove(id1))
+	assert.Nil(t, testQueue.Remove(id1))
+	assert.Equal(t, []string{}, testQueue.Segments())
+
+	id2, err = testQueue.Put([]byte("test2\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000000000000001.seg", id2)
+	assert.Equal(t, []string{id2}, testQueue.Segments())
+
+	_, err = testQueue.Read(id1)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+type Backoff interface {
+	Next() (time.Duration, bool)
+}
+
+type Options struct {
+	MaxAttempts    uint
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+	MaxElapsedTime time.Duration
+}
+
+type backoff struct {
+	options  Options
+	attempts uint
+	delay    time.Duration
+	started  time.Time
+}
+
+func New(options *Options) Backoff {
+	return &backoff{
+		options:  *options,
+		attempts: 1,
+		delay:    options.InitialBackoff,
+		started:  time.Now(),
+	}
+}
+
+func (b *backoff) Next() (time.Duration, bool) {
+	if b.attempts >= b.options.MaxAttempts {
+		return 0, false
+	}
+
+	delay := b.delay
+	if b.options.MaxBackoff > 0 && delay > b.options.MaxBackoff {
+		delay = b.options.MaxBackoff
+	}
+
+	if b.options.Jitter > 0 {
+		delta := b.options.Jitter * float64(delay)
+		delay = time.Duration(float64(delay) - delta + rand.Float64()*2*delta) //nolint:gosec
+	}
+
+	if b.options.MaxElapsedTime > 0 && time.Since(b.started)+delay > b.options.MaxElapsedTime {
+		return 0, false
+	}
+
+	b.attempts++
+
+	if b.options.MaxBackoff == 0 || b.delay < b.options.MaxBackoff {
+		b.delay *= 2
+	}
+
+	return delay, true
+}
@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	testBackoff := New(&Options{})
+	assert.IsType(t, &backoff{}, testBackoff)
+
+	delay, ok := testBackoff.Next()
+	assert.Equal(t, time.Duration(0), delay)
+	assert.False(t, ok)
+}
+
+func Test_Next(t *testing.T) {
+	tables := []struct {
+		options *Options
+		delays  []time.Duration
+	}{
+		{
+			options: &Options{
+				MaxAttempts:    1,
+				InitialBackoff: time.Second,
+			},
+			delays: []time.Duration{},
+		},
+		{
+			options: &Options{
+				MaxAttempts:    4,
+				InitialBackoff: time.Second,
+			},
+			delays: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			options: &Options{
+				MaxAttempts:    5,
+				InitialBackoff: time.Second,
+				MaxBackoff:     3 * time.Second,
+			},
+			delays: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			options: &Options{
+				MaxAttempts:    5,
+				InitialBackoff: time.Second,
+				MaxElapsedTime: 3 * time.Second,
+			},
+			delays: []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+
+	for tt, table := range tables {
+		testBackoff := New(table.options)
+
+		delays := make([]time.Duration, 0)
+		for {
+			delay, ok := testBackoff.Next()
+			if !ok {
+				break
+			}
+			delays = append(delays, delay)
+		}
+
+		assert.Equalf(t, table.delays, delays, "%d", tt)
+	}
+}
+
+func Test_Next_Jitter(t *testing.T) {
+	testBackoff := New(&Options{
+		MaxAttempts:    100,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second,
+		Jitter:         0.5,
+	})
+
+	for i := 0; i < 99; i++ {
+		delay, ok := testBackoff.Next()
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, 1500*time.Millisecond)
+	}
+}
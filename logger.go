@@ -1,12 +1,113 @@
 package writer
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"strings"
+)
 
 type Logger interface {
 	Infof(template string, args ...interface{})
 	Errorf(template string, args ...interface{})
 }
 
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", l)
+}
+
+func ParseLevel(level string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(level, l.String()) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level: %s", level)
+}
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger receives leveled messages with key/value fields, such as
+// request_id, status_code, size and entries of a batch.
+type StructuredLogger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// FormatFields formats the message and the fields as "msg: key: value, ...".
+func FormatFields(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+
+	b := strings.Builder{}
+	b.WriteString(msg)
+	b.WriteString(": ")
+
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+
+		fmt.Fprintf(&b, "%s: %v", f.Key, f.Value)
+	}
+
+	return b.String()
+}
+
+// formatLogger adapts a Logger, debug and info messages go to Infof, warnings
+// and errors to Errorf.
+type formatLogger struct {
+	logger Logger
+}
+
+func (l *formatLogger) Log(level Level, msg string, fields ...Field) {
+	if level >= LevelWarn {
+		l.logger.Errorf("%s", FormatFields(msg, fields))
+		return
+	}
+
+	l.logger.Infof("%s", FormatFields(msg, fields))
+}
+
+func newStructuredLogger(options *Options) StructuredLogger {
+	if options.StructuredLogger != nil {
+		return options.StructuredLogger
+	}
+
+	if logger, ok := options.Logger.(StructuredLogger); ok {
+		return logger
+	}
+
+	if options.Logger == nil {
+		return &defaultLogger{}
+	}
+
+	return &formatLogger{logger: options.Logger}
+}
+
 type defaultLogger struct{}
 
 func (l *defaultLogger) Infof(template string, args ...interface{}) {
@@ -16,3 +117,7 @@ func (l *defaultLogger) Infof(template string, args ...interface{}) {
 func (l *defaultLogger) Errorf(template string, args ...interface{}) {
 	log.Printf("ERROR writer: "+template, args...)
 }
+
+func (l *defaultLogger) Log(level Level, msg string, fields ...Field) {
+	log.Printf("%s writer: %s", level, FormatFields(msg, fields))
+}
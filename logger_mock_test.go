@@ -1,16 +1,42 @@
 package writer
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 type mockLogger struct {
+	lock       sync.Mutex
+	Lines      []string
 	InfoLines  []string
 	ErrorLines []string
 }
 
 func (l *mockLogger) Infof(template string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
 	l.InfoLines = append(l.InfoLines, fmt.Sprintf(template, args...))
 }
 
 func (l *mockLogger) Errorf(template string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
 	l.ErrorLines = append(l.ErrorLines, fmt.Sprintf(template, args...))
 }
+
+func (l *mockLogger) Log(level Level, msg string, fields ...Field) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	line := FormatFields(msg, fields)
+	l.Lines = append(l.Lines, level.String()+" "+line)
+
+	switch level {
+	case LevelInfo:
+		l.InfoLines = append(l.InfoLines, line)
+	case LevelError:
+		l.ErrorLines = append(l.ErrorLines, line)
+	}
+}
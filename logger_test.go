@@ -0,0 +1,90 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Level(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		parsed, err := ParseLevel(level.String())
+		assert.Nil(t, err)
+		assert.Equal(t, level, parsed)
+	}
+
+	level, err := ParseLevel("warn")
+	assert.Nil(t, err)
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("trace")
+	assert.EqualError(t, err, "unknown log level: trace")
+
+	assert.Equal(t, "LEVEL(10)", Level(10).String())
+}
+
+func Test_FormatFields(t *testing.T) {
+	assert.Equal(t, "started", FormatFields("started", nil))
+	assert.Equal(t, "send batch: request_id: id, size: 10, error: test",
+		FormatFields("send batch", []Field{
+			{"request_id", "id"},
+			{"size", 10},
+			{"error", errors.New("test")},
+		}))
+}
+
+type legacyLogger struct {
+	InfoLines  []string
+	ErrorLines []string
+}
+
+func (l *legacyLogger) Infof(template string, args ...interface{}) {
+	l.InfoLines = append(l.InfoLines, fmt.Sprintf(template, args...))
+}
+
+func (l *legacyLogger) Errorf(template string, args ...interface{}) {
+	l.ErrorLines = append(l.ErrorLines, fmt.Sprintf(template, args...))
+}
+
+func Test_newStructuredLogger(t *testing.T) {
+	structured := &mockLogger{}
+	assert.Equal(t, structured, newStructuredLogger(DefaultOptions().
+		SetLogger(&mockLogger{}).
+		SetStructuredLogger(structured)))
+
+	assert.Equal(t, structured, newStructuredLogger(DefaultOptions().
+		SetLogger(structured)))
+
+	assert.IsType(t, &defaultLogger{}, newStructuredLogger(DefaultOptions()))
+	assert.IsType(t, &defaultLogger{}, newStructuredLogger(DefaultOptions().
+		SetLogger(nil)))
+
+	legacy := &legacyLogger{}
+	logger := newStructuredLogger(DefaultOptions().SetLogger(legacy))
+	assert.IsType(t, &formatLogger{}, logger)
+
+	logger.Log(LevelDebug, "send batch", Field{"size", 1})
+	logger.Log(LevelInfo, "started")
+	logger.Log(LevelWarn, "send batch: retry", Field{"delay", "1s"})
+	logger.Log(LevelError, "client.send", Field{"error", "test"})
+
+	assert.Equal(t, []string{"send batch: size: 1", "started"}, legacy.InfoLines)
+	assert.Equal(t, []string{"send batch: retry: delay: 1s", "client.send: error: test"}, legacy.ErrorLines)
+}
+
+func Test_log(t *testing.T) {
+	logger := &mockLogger{}
+	testWriter := &writer{
+		logger:   logger,
+		logLevel: LevelWarn,
+	}
+
+	testWriter.log(LevelDebug, "debug")
+	testWriter.log(LevelInfo, "info")
+	testWriter.log(LevelWarn, "warn")
+	testWriter.log(LevelError, "error", Field{"status_code", 400})
+
+	assert.Equal(t, []string{"WARN warn", "ERROR error: status_code: 400"}, logger.Lines)
+}
@@ -0,0 +1,218 @@
+// Package metrics exposes writer stats in the Prometheus text format without
+// depending on the Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+)
+
+const namespace = "influxdb_writer_"
+
+type Source interface {
+	Stats() writer.Stats
+}
+
+type source struct {
+	source    Source
+	serverURL string
+	bucket    string
+}
+
+type Handler struct {
+	lock    sync.RWMutex
+	sources []source
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// Register adds the writer to the handler, its metrics are labeled with the
+// server url and the bucket.
+func (h *Handler) Register(s Source, serverURL, bucket string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.sources = append(h.sources, source{
+		source:    s,
+		serverURL: serverURL,
+		bucket:    bucket,
+	})
+}
+
+func (h *Handler) Unregister(s Source) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	sources := h.sources[:0]
+	for _, registered := range h.sources {
+		if registered.source != s {
+			sources = append(sources, registered)
+		}
+	}
+
+	h.sources = sources
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	_ = h.Write(w)
+}
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(stats *writer.Stats) float64
+}
+
+var metrics = []metric{
+	{"lines_accepted_total", "counter", "Lines added to a batch.",
+		func(s *writer.Stats) float64 { return float64(s.LinesAccepted) }},
+	{"lines_rejected_total", "counter", "Lines rejected before or by the server.",
+		func(s *writer.Stats) float64 { return float64(s.LinesRejected) }},
+	{"batches_sent_total", "counter", "Batches delivered to the server.",
+		func(s *writer.Stats) float64 { return float64(s.BatchesSent) }},
+	{"batches_failed_total", "counter", "Batches dropped after the last attempt.",
+		func(s *writer.Stats) float64 { return float64(s.BatchesFailed) }},
+	{"sent_bytes_total", "counter", "Uncompressed size of the delivered batches.",
+		func(s *writer.Stats) float64 { return float64(s.BytesSent) }},
+	{"sent_entries_total", "counter", "Entries of the delivered batches.",
+		func(s *writer.Stats) float64 { return float64(s.EntriesSent) }},
+	{"retries_total", "counter", "Attempts retried after a temporary failure.",
+		func(s *writer.Stats) float64 { return float64(s.Retries) }},
+	{"dropped_entries_total", "counter", "Entries that were lost.",
+		func(s *writer.Stats) float64 { return float64(s.DroppedEntries) }},
+	{"overflowed_lines_total", "counter", "Lines dropped by the overflow policy.",
+		func(s *writer.Stats) float64 { return float64(s.LinesOverflowed) }},
+	{"spilled_lines_total", "counter", "Lines written to the spill file.",
+		func(s *writer.Stats) float64 { return float64(s.LinesSpilled) }},
+	{"input_queue_entries", "gauge", "Entries waiting in the input queue.",
+		func(s *writer.Stats) float64 { return float64(s.InputQueueLength) }},
+	{"buffer_bytes", "gauge", "Size of the batch being written.",
+		func(s *writer.Stats) float64 { return float64(s.BufferSize) }},
+	{"buffer_entries", "gauge", "Entries of the batch being written.",
+		func(s *writer.Stats) float64 { return float64(s.BufferEntries) }},
+	{"pending_batches", "gauge", "Full batches waiting for a sender.",
+		func(s *writer.Stats) float64 { return float64(s.PendingBatches) }},
+	{"last_error_timestamp_seconds", "gauge", "Time of the last error.",
+		func(s *writer.Stats) float64 {
+			if s.LastErrorTime.IsZero() {
+				return 0
+			}
+			return float64(s.LastErrorTime.UnixNano()) / 1e9
+		}},
+}
+
+type replicaMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(stats *writer.ReplicaStats) float64
+}
+
+// replicaMetrics are labeled with the server url of the replica too.
+var replicaMetrics = []replicaMetric{
+	{"replica_batches_sent_total", "counter", "Batches delivered to the replica.",
+		func(s *writer.ReplicaStats) float64 { return float64(s.BatchesSent) }},
+	{"replica_batches_failed_total", "counter", "Batches not delivered to the replica.",
+		func(s *writer.ReplicaStats) float64 { return float64(s.BatchesFailed) }},
+	{"replica_sent_entries_total", "counter", "Entries of the batches delivered to the replica.",
+		func(s *writer.ReplicaStats) float64 { return float64(s.EntriesSent) }},
+	{"replica_dropped_entries_total", "counter", "Entries lost for the replica.",
+		func(s *writer.ReplicaStats) float64 { return float64(s.DroppedEntries) }},
+	{"replica_pending_batches", "gauge", "Batches waiting for the replica.",
+		func(s *writer.ReplicaStats) float64 { return float64(s.PendingBatches) }},
+}
+
+// Write writes the metrics of all registered writers in the Prometheus text
+// format.
+func (h *Handler) Write(w io.Writer) error {
+	h.lock.RLock()
+	sources := make([]source, len(h.sources))
+	copy(sources, h.sources)
+	h.lock.RUnlock()
+
+	stats := make([]writer.Stats, len(sources))
+	labels := make([]string, len(sources))
+
+	for i, s := range sources {
+		stats[i] = s.source.Stats()
+		labels[i] = fmt.Sprintf(`server_url="%s",bucket="%s"`,
+			escape(s.serverURL), escape(s.bucket))
+	}
+
+	buf := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "# HELP %s%s %s\n", namespace, m.name, m.help)
+		fmt.Fprintf(buf, "# TYPE %s%s %s\n", namespace, m.name, m.kind)
+
+		for i := range stats {
+			fmt.Fprintf(buf, "%s%s{%s} %s\n", namespace, m.name, labels[i],
+				formatFloat(m.value(&stats[i])))
+		}
+	}
+
+	replicas := 0
+	for i := range stats {
+		replicas += len(stats[i].Replicas)
+	}
+
+	for _, m := range replicaMetrics {
+		if replicas == 0 {
+			break
+		}
+
+		fmt.Fprintf(buf, "# HELP %s%s %s\n", namespace, m.name, m.help)
+		fmt.Fprintf(buf, "# TYPE %s%s %s\n", namespace, m.name, m.kind)
+
+		for i := range stats {
+			for j := range stats[i].Replicas {
+				replica := &stats[i].Replicas[j]
+
+				fmt.Fprintf(buf, "%s%s{%s,replica=\"%s\"} %s\n", namespace, m.name, labels[i],
+					escape(replica.ServerURL), formatFloat(m.value(replica)))
+			}
+		}
+	}
+
+	name := namespace + "send_duration_seconds"
+
+	fmt.Fprintf(buf, "# HELP %s Duration of the write requests.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+
+	for i := range stats {
+		histogram := stats[i].SendLatency
+
+		for _, bucket := range histogram.Buckets {
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels[i],
+				formatFloat(bucket.UpperBound.Seconds()), bucket.Count)
+		}
+
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels[i], histogram.Count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels[i], formatFloat(histogram.Sum.Seconds()))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels[i], histogram.Count)
+	}
+
+	return buf.Flush()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
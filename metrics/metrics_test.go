@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSource struct {
+	stats writer.Stats
+}
+
+func (s *testSource) Stats() writer.Stats {
+	return s.stats
+}
+
+func Test_Handler(t *testing.T) {
+	first := &testSource{stats: writer.Stats{
+		LinesAccepted:  123456789,
+		BatchesSent:    2,
+		BufferSize:     10,
+		LastErrorTime:  time.Unix(1600000000, 500000000),
+		PendingBatches: 1,
+		LinesSpilled:   3,
+		Replicas: []writer.ReplicaStats{
+			{ServerURL: "http://replica:8086", BatchesSent: 5, PendingBatches: 4},
+		},
+		SendLatency: writer.LatencyHistogram{
+			Buckets: []writer.LatencyBucket{
+				{UpperBound: 5 * time.Millisecond, Count: 1},
+				{UpperBound: 2500 * time.Millisecond, Count: 2},
+			},
+			Count: 3,
+			Sum:   1500 * time.Millisecond,
+		},
+	}}
+	second := &testSource{}
+
+	handler := NewHandler()
+	handler.Register(first, "http://localhost:8086", "raw")
+	handler.Register(second, "http://localhost:8086", `a"b\c`)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(body, "# TYPE influxdb_writer_lines_accepted_total counter\n"))
+
+	for _, line := range []string{
+		`influxdb_writer_lines_accepted_total{server_url="http://localhost:8086",bucket="raw"} 123456789`,
+		`influxdb_writer_lines_accepted_total{server_url="http://localhost:8086",bucket="a\"b\\c"} 0`,
+		`influxdb_writer_batches_sent_total{server_url="http://localhost:8086",bucket="raw"} 2`,
+		`influxdb_writer_buffer_bytes{server_url="http://localhost:8086",bucket="raw"} 10`,
+		`influxdb_writer_pending_batches{server_url="http://localhost:8086",bucket="raw"} 1`,
+		`influxdb_writer_spilled_lines_total{server_url="http://localhost:8086",bucket="raw"} 3`,
+		`influxdb_writer_replica_batches_sent_total{server_url="http://localhost:8086",bucket="raw",replica="http://replica:8086"} 5`,
+		`influxdb_writer_replica_pending_batches{server_url="http://localhost:8086",bucket="raw",replica="http://replica:8086"} 4`,
+		`influxdb_writer_last_error_timestamp_seconds{server_url="http://localhost:8086",bucket="raw"} 1600000000.5`,
+		`influxdb_writer_last_error_timestamp_seconds{server_url="http://localhost:8086",bucket="a\"b\\c"} 0`,
+		`# TYPE influxdb_writer_send_duration_seconds histogram`,
+		`influxdb_writer_send_duration_seconds_bucket{server_url="http://localhost:8086",bucket="raw",le="0.005"} 1`,
+		`influxdb_writer_send_duration_seconds_bucket{server_url="http://localhost:8086",bucket="raw",le="2.5"} 2`,
+		`influxdb_writer_send_duration_seconds_bucket{server_url="http://localhost:8086",bucket="raw",le="+Inf"} 3`,
+		`influxdb_writer_send_duration_seconds_sum{server_url="http://localhost:8086",bucket="raw"} 1.5`,
+		`influxdb_writer_send_duration_seconds_count{server_url="http://localhost:8086",bucket="raw"} 3`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	handler.Unregister(first)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotContains(t, recorder.Body.String(), `bucket="raw"`)
+	assert.Contains(t, recorder.Body.String(), `bucket="a\"b\\c"`)
+}
@@ -1,45 +1,178 @@
 package writer
 
 import (
+	"compress/gzip"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/a-kataev/go-influxdb-writer/internal/batch"
 	"github.com/a-kataev/go-influxdb-writer/internal/client"
+	"github.com/a-kataev/go-influxdb-writer/internal/queue"
+	"github.com/a-kataev/go-influxdb-writer/internal/retry"
 )
 
+const (
+	APIv1 = client.APIv1
+	APIv2 = client.APIv2
+)
+
+// OverflowPolicy selects what happens to a line written while the input
+// queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until the line fits.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the written line.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest line of the input queue.
+	OverflowDropOldest
+	// OverflowSpill writes the line to a file in the spill directory.
+	OverflowSpill
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSpill:
+		return "spill"
+	}
+
+	return fmt.Sprintf("overflow(%d)", p)
+}
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	for p := OverflowBlock; p <= OverflowSpill; p++ {
+		if strings.EqualFold(policy, p.String()) {
+			return p, nil
+		}
+	}
+
+	return OverflowBlock, fmt.Errorf("unknown overflow policy: %s", policy)
+}
+
 type Options struct {
-	Client *client.Options
-	Batch  *batch.Options
-	Writer *writerOptions
-	Logger Logger
+	Client           *client.Options
+	Batch            *batch.Options
+	Writer           *writerOptions
+	Retry            *retry.Options
+	Queue            *queue.Options
+	Logger           Logger
+	StructuredLogger StructuredLogger
+	LogLevel         Level
+	ErrorHandler     func(*WriteError)
+	DeadLetter       DeadLetter
+	Tracer           Tracer
+	Router           Router
+	Replicas         []Replica
 }
 
 func DefaultOptions() *Options {
 	return &Options{
 		Client: &client.Options{
+			APIVersion:  APIv2,
 			ServerURL:   "http://localhost:8086",
 			AuthToken:   "admin:password",
 			Bucket:      "test",
 			Precision:   "ns",
 			HTTPTimeout: 8 * time.Second,
+			GzipLevel:   gzip.DefaultCompression,
 		},
 		Batch: &batch.Options{
 			BufferSize:   1024 * 1024 * 3,
 			EntriesLimit: 5000,
+			GzipLevel:    gzip.DefaultCompression,
 		},
 		Writer: &writerOptions{
-			SendInterval: 10 * time.Second,
-			SendTimeout:  9 * time.Second,
+			SendInterval:      10 * time.Second,
+			SendTimeout:       9 * time.Second,
+			MaxInFlight:       1,
+			Concurrency:       1,
+			InputQueueSize:    1000,
+			OverflowPolicy:    OverflowBlock,
+			SpillMaxSize:      1024 * 1024 * 1024,
+			ReplicaMaxPending: 10,
+		},
+		Retry: &retry.Options{
+			MaxAttempts:    5,
+			InitialBackoff: 1 * time.Second,
+			MaxBackoff:     30 * time.Second,
+			Jitter:         0.2,
+			MaxElapsedTime: 1 * time.Minute,
 		},
-		Logger: &defaultLogger{},
+		Queue: &queue.Options{
+			MaxSize: 1024 * 1024 * 1024,
+		},
+		Logger:   &defaultLogger{},
+		LogLevel: LevelInfo,
 	}
 }
 
+func (o *Options) Validate() error {
+	if o.Writer.OverflowPolicy == OverflowSpill && len(o.Writer.SpillDir) == 0 {
+		return ErrSpillDirRequired
+	}
+
+	for _, replica := range o.Replicas {
+		if len(replica.ServerURL) == 0 {
+			return ErrReplicaURLRequired
+		}
+	}
+
+	return o.Client.Validate()
+}
+
 func (o *Options) SetLogger(logger Logger) *Options {
 	o.Logger = logger
 	return o
 }
 
+func (o *Options) SetStructuredLogger(logger StructuredLogger) *Options {
+	o.StructuredLogger = logger
+	return o
+}
+
+func (o *Options) SetLogLevel(level Level) *Options {
+	o.LogLevel = level
+	return o
+}
+
+func (o *Options) SetErrorHandler(handler func(*WriteError)) *Options {
+	o.ErrorHandler = handler
+	return o
+}
+
+func (o *Options) SetDeadLetter(deadLetter DeadLetter) *Options {
+	o.DeadLetter = deadLetter
+	return o
+}
+
+func (o *Options) SetTracer(tracer Tracer) *Options {
+	o.Tracer = tracer
+	return o
+}
+
+func (o *Options) SetRouter(router Router) *Options {
+	o.Router = router
+	return o
+}
+
+func (o *Options) AddReplica(replica Replica) *Options {
+	o.Replicas = append(o.Replicas, replica)
+	return o
+}
+
+func (o *Options) SetReplicaMaxPending(batches uint) *Options {
+	o.Writer.ReplicaMaxPending = batches
+	return o
+}
+
 func (o *Options) SetSendInterval(interval time.Duration) *Options {
 	o.Writer.SendInterval = interval
 	return o
@@ -50,6 +183,41 @@ func (o *Options) SetSendTimeout(timeout time.Duration) *Options {
 	return o
 }
 
+func (o *Options) SetMaxInFlight(batches uint) *Options {
+	o.Writer.MaxInFlight = batches
+	return o
+}
+
+func (o *Options) SetConcurrency(senders uint) *Options {
+	o.Writer.Concurrency = senders
+	return o
+}
+
+func (o *Options) SetValidateLines(enabled bool) *Options {
+	o.Writer.ValidateLines = enabled
+	return o
+}
+
+func (o *Options) SetInputQueueSize(size uint) *Options {
+	o.Writer.InputQueueSize = size
+	return o
+}
+
+func (o *Options) SetOverflowPolicy(policy OverflowPolicy) *Options {
+	o.Writer.OverflowPolicy = policy
+	return o
+}
+
+func (o *Options) SetSpillDir(dir string) *Options {
+	o.Writer.SpillDir = dir
+	return o
+}
+
+func (o *Options) SetSpillMaxSize(size uint64) *Options {
+	o.Writer.SpillMaxSize = size
+	return o
+}
+
 func (o *Options) SetServerURL(url string) *Options {
 	o.Client.ServerURL = url
 	return o
@@ -60,11 +228,56 @@ func (o *Options) SetAuthToken(token string) *Options {
 	return o
 }
 
+func (o *Options) SetOrg(org string) *Options {
+	o.Client.Org = org
+	return o
+}
+
+func (o *Options) SetOrgID(id string) *Options {
+	o.Client.OrgID = id
+	return o
+}
+
 func (o *Options) SetBucket(bucket string) *Options {
 	o.Client.Bucket = bucket
 	return o
 }
 
+func (o *Options) SetAPIVersion(version string) *Options {
+	o.Client.APIVersion = version
+	return o
+}
+
+func (o *Options) SetDatabase(database string) *Options {
+	o.Client.Database = database
+	return o
+}
+
+func (o *Options) SetRetentionPolicy(rp string) *Options {
+	o.Client.RetentionPolicy = rp
+	return o
+}
+
+func (o *Options) SetConsistency(consistency string) *Options {
+	o.Client.Consistency = consistency
+	return o
+}
+
+func (o *Options) SetUsername(username string) *Options {
+	o.Client.Username = username
+	return o
+}
+
+func (o *Options) SetPassword(password string) *Options {
+	o.Client.Password = password
+	return o
+}
+
+func (o *Options) SetBasicAuth(enabled bool) *Options {
+	o.Client.BasicAuth = enabled
+	return o
+}
+
 func (o *Options) SetPrecision(precision string) *Options {
 	o.Client.Precision = precision
 	return o
@@ -75,6 +288,22 @@ func (o *Options) SetHTTPTimeout(timeout time.Duration) *Options {
 	return o
 }
 
+func (o *Options) SetGzip(enabled bool) *Options {
+	o.Client.Gzip = enabled
+	return o
+}
+
+func (o *Options) SetGzipLevel(level int) *Options {
+	o.Client.GzipLevel = level
+	o.Batch.GzipLevel = level
+	return o
+}
+
+func (o *Options) SetCompressedBatchSize(enabled bool) *Options {
+	o.Batch.CompressedSize = enabled
+	return o
+}
+
 func (o *Options) SetBatchSize(size uint64) *Options {
 	o.Batch.BufferSize = size
 	return o
@@ -84,3 +313,38 @@ func (o *Options) SetEntriesLimit(limit uint64) *Options {
 	o.Batch.EntriesLimit = limit
 	return o
 }
+
+func (o *Options) SetRetryMaxAttempts(attempts uint) *Options {
+	o.Retry.MaxAttempts = attempts
+	return o
+}
+
+func (o *Options) SetRetryInitialBackoff(backoff time.Duration) *Options {
+	o.Retry.InitialBackoff = backoff
+	return o
+}
+
+func (o *Options) SetRetryMaxBackoff(backoff time.Duration) *Options {
+	o.Retry.MaxBackoff = backoff
+	return o
+}
+
+func (o *Options) SetRetryJitter(jitter float64) *Options {
+	o.Retry.Jitter = jitter
+	return o
+}
+
+func (o *Options) SetRetryMaxElapsedTime(elapsed time.Duration) *Options {
+	o.Retry.MaxElapsedTime = elapsed
+	return o
+}
+
+func (o *Options) SetQueueDir(dir string) *Options {
+	o.Queue.Dir = dir
+	return o
+}
+
+func (o *Options) SetQueueMaxSize(size uint64) *Options {
+	o.Queue.MaxSize = size
+	return o
+}
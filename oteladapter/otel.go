@@ -0,0 +1,89 @@
+// Package oteladapter creates OpenTelemetry spans for the write requests of
+// the writer and propagates the trace context in the request headers.
+package oteladapter
+
+import (
+	"context"
+	"net/http"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/a-kataev/go-influxdb-writer"
+	spanName            = "influxdb.write"
+)
+
+var (
+	BucketKey     = attribute.Key("influxdb.bucket")
+	SizeKey       = attribute.Key("influxdb.batch.size")
+	EntriesKey    = attribute.Key("influxdb.batch.entries")
+	AttemptKey    = attribute.Key("influxdb.attempt")
+	StatusCodeKey = attribute.Key("http.status_code")
+	RequestIDKey  = attribute.Key("influxdb.request_id")
+)
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New returns a writer.Tracer, nil provider and propagator default to the
+// global ones.
+func New(provider trace.TracerProvider, propagator propagation.TextMapPropagator) writer.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	return &tracer{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagator,
+	}
+}
+
+func (t *tracer) Start(ctx context.Context, info writer.SendInfo) (context.Context, writer.Span) {
+	ctx, s := t.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			BucketKey.String(info.Bucket),
+			SizeKey.Int64(int64(info.Size)),
+			EntriesKey.Int64(int64(info.Entries)),
+			AttemptKey.Int64(int64(info.Attempt)),
+		))
+
+	return ctx, &span{span: s}
+}
+
+func (t *tracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) End(result writer.SendResult) {
+	if result.StatusCode > 0 {
+		s.span.SetAttributes(StatusCodeKey.Int(result.StatusCode))
+	}
+
+	if len(result.RequestID) > 0 {
+		s.span.SetAttributes(RequestIDKey.String(result.RequestID))
+	}
+
+	if result.Err != nil {
+		s.span.RecordError(result.Err)
+		s.span.SetStatus(codes.Error, result.Err.Error())
+	}
+
+	s.span.End()
+}
@@ -0,0 +1,70 @@
+package oteladapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_Tracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := New(provider, propagation.TraceContext{})
+
+	ctx, span := tracer.Start(context.Background(), writer.SendInfo{
+		Bucket:  "bucket",
+		Size:    10,
+		Entries: 2,
+		Attempt: 1,
+	})
+
+	header := http.Header{}
+	tracer.Inject(ctx, header)
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	assert.Equal(t, "00-"+spanContext.TraceID().String()+"-"+spanContext.SpanID().String()+"-01",
+		header.Get("Traceparent"))
+
+	span.End(writer.SendResult{
+		StatusCode: 503,
+		RequestID:  "id",
+		Err:        errors.New("test"),
+	})
+
+	_, span = tracer.Start(context.Background(), writer.SendInfo{Attempt: 2})
+	span.End(writer.SendResult{})
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, spanName, spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Equal(t, []attribute.KeyValue{
+		BucketKey.String("bucket"),
+		SizeKey.Int64(10),
+		EntriesKey.Int64(2),
+		AttemptKey.Int64(1),
+		StatusCodeKey.Int(503),
+		RequestIDKey.String("id"),
+	}, spans[0].Attributes())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "test", spans[0].Status().Description)
+	assert.Len(t, spans[0].Events(), 1)
+
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	assert.Len(t, spans[1].Attributes(), 4)
+}
+
+func Test_New(t *testing.T) {
+	assert.NotNil(t, New(nil, nil))
+}
@@ -0,0 +1,153 @@
+package writer
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+type fieldKind uint8
+
+const (
+	fieldInt fieldKind = iota
+	fieldUint
+	fieldFloat
+	fieldBool
+	fieldString
+)
+
+type tag struct {
+	key   string
+	value string
+}
+
+type field struct {
+	key  string
+	kind fieldKind
+	i    int64
+	u    uint64
+	f    float64
+	s    string
+	b    bool
+}
+
+type Point struct {
+	measurement string
+	tags        []tag
+	fields      []field
+	time        time.Time
+}
+
+var (
+	ErrEmptyMeasurement = errors.New("point: empty measurement")
+	ErrEmptyKey         = errors.New("point: empty field key")
+	ErrNoFields         = errors.New("point: no fields")
+	ErrInvalidFloat     = errors.New("point: field value is NaN or Inf")
+	ErrNewline          = errors.New("point: newline in measurement, key or value")
+	ErrTrailingEscape   = errors.New("point: measurement, key or tag value ends with backslash")
+)
+
+func NewPoint(measurement string) *Point {
+	return &Point{
+		measurement: measurement,
+	}
+}
+
+func (p *Point) AddTag(key, value string) *Point {
+	p.tags = append(p.tags, tag{key: key, value: value})
+	return p
+}
+
+func (p *Point) AddIntField(key string, value int64) *Point {
+	p.fields = append(p.fields, field{key: key, kind: fieldInt, i: value})
+	return p
+}
+
+func (p *Point) AddUintField(key string, value uint64) *Point {
+	p.fields = append(p.fields, field{key: key, kind: fieldUint, u: value})
+	return p
+}
+
+func (p *Point) AddFloatField(key string, value float64) *Point {
+	p.fields = append(p.fields, field{key: key, kind: fieldFloat, f: value})
+	return p
+}
+
+func (p *Point) AddBoolField(key string, value bool) *Point {
+	p.fields = append(p.fields, field{key: key, kind: fieldBool, b: value})
+	return p
+}
+
+func (p *Point) AddStringField(key, value string) *Point {
+	p.fields = append(p.fields, field{key: key, kind: fieldString, s: value})
+	return p
+}
+
+func (p *Point) SetTime(t time.Time) *Point {
+	p.time = t
+	return p
+}
+
+func (p *Point) validate() error {
+	if len(p.measurement) == 0 {
+		return ErrEmptyMeasurement
+	}
+
+	if len(p.fields) == 0 {
+		return ErrNoFields
+	}
+
+	if err := validateName(p.measurement); err != nil {
+		return err
+	}
+
+	for _, t := range p.tags {
+		if len(t.key) == 0 || len(t.value) == 0 {
+			continue
+		}
+
+		if err := validateName(t.key); err != nil {
+			return err
+		}
+
+		if err := validateName(t.value); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range p.fields {
+		if len(f.key) == 0 {
+			return ErrEmptyKey
+		}
+
+		if err := validateName(f.key); err != nil {
+			return err
+		}
+
+		if f.kind == fieldFloat && (math.IsNaN(f.f) || math.IsInf(f.f, 0)) {
+			return ErrInvalidFloat
+		}
+
+		if f.kind == fieldString && strings.IndexByte(f.s, '\n') >= 0 {
+			return ErrNewline
+		}
+	}
+
+	return nil
+}
+
+// validateName checks the measurement, keys and tag values, which are escaped
+// without quotes: a newline would split the line, and a trailing backslash
+// would escape the separator after it.
+func validateName(name string) error {
+	if strings.IndexByte(name, '\n') >= 0 {
+		return ErrNewline
+	}
+
+	if name[len(name)-1] == '\\' {
+		return ErrTrailingEscape
+	}
+
+	return nil
+}
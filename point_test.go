@@ -0,0 +1,72 @@
+package writer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Point_validate(t *testing.T) {
+	tables := []struct {
+		point *Point
+		err   error
+	}{
+		{
+			point: NewPoint("cpu").AddIntField("value", 1),
+			err:   nil,
+		},
+		{
+			point: NewPoint("").AddIntField("value", 1),
+			err:   ErrEmptyMeasurement,
+		},
+		{
+			point: NewPoint("cpu").AddTag("host", "test"),
+			err:   ErrNoFields,
+		},
+		{
+			point: NewPoint("cpu").AddIntField("", 1),
+			err:   ErrEmptyKey,
+		},
+		{
+			point: NewPoint("cpu").AddFloatField("value", math.NaN()),
+			err:   ErrInvalidFloat,
+		},
+		{
+			point: NewPoint("cpu").AddFloatField("value", math.Inf(-1)),
+			err:   ErrInvalidFloat,
+		},
+		{
+			point: NewPoint("cpu\nmem").AddIntField("value", 1),
+			err:   ErrNewline,
+		},
+		{
+			point: NewPoint("cpu").AddTag("host", "a\nb").AddIntField("value", 1),
+			err:   ErrNewline,
+		},
+		{
+			point: NewPoint("cpu").AddIntField("va\nlue", 1),
+			err:   ErrNewline,
+		},
+		{
+			point: NewPoint("cpu").AddStringField("value", "a\nb"),
+			err:   ErrNewline,
+		},
+		{
+			point: NewPoint("cpu\\").AddIntField("value", 1),
+			err:   ErrTrailingEscape,
+		},
+		{
+			point: NewPoint("cpu").AddTag("path", `c:\`).AddIntField("value", 1),
+			err:   ErrTrailingEscape,
+		},
+		{
+			point: NewPoint("cpu").AddTag("", `c:\`).AddTag("path", `c:\temp`).AddStringField("value", `c:\`),
+			err:   nil,
+		},
+	}
+
+	for tt, table := range tables {
+		assert.Equalf(t, table.err, table.point.validate(), "%d", tt)
+	}
+}
@@ -0,0 +1,389 @@
+package writer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-kataev/go-influxdb-writer/internal/client"
+	"github.com/a-kataev/go-influxdb-writer/internal/queue"
+	"github.com/a-kataev/go-influxdb-writer/internal/retry"
+)
+
+// Replica is another server, which receives every batch. Empty fields are
+// taken from the client options of the writer.
+type Replica struct {
+	ServerURL string
+	AuthToken string
+	Org       string
+	OrgID     string
+	Bucket    string
+	Database  string
+	Username  string
+	Password  string
+}
+
+// replica delivers the batches to one server. With replicas, the primary
+// server is a replica too: every server has its own pending batches, senders,
+// retries and durable queue, so that an outage of one server does not hold
+// the others.
+type replica struct {
+	// stats must be the first field, see the stats type. The primary server
+	// counts to the stats of the writer.
+	stats   stats
+	url     string
+	primary bool
+	options client.Options
+	bucket  string
+	routes  map[string]*route
+	routeOf func(bucket string) *route
+	lock    sync.Mutex
+	pending chan *replicaJob
+	queue   queue.Queue
+	parked  []string
+	// delay is the backoff of the parked segments after a failed delivery,
+	// they are not taken before retryAt.
+	delay   time.Duration
+	retryAt time.Time
+	paused  pauser
+	done    chan struct{}
+}
+
+// replicaJob is a batch for one server, seq is set for the primary server.
+type replicaJob struct {
+	bucket  string
+	data    []byte
+	entries uint64
+	seq     uint64
+}
+
+func (w *writer) newReplica(options Replica, writerOptions *Options) *replica {
+	clientOptions := *w.clientOptions
+
+	for _, option := range []struct {
+		value  string
+		target *string
+	}{
+		{options.ServerURL, &clientOptions.ServerURL},
+		{options.AuthToken, &clientOptions.AuthToken},
+		{options.Org, &clientOptions.Org},
+		{options.OrgID, &clientOptions.OrgID},
+		{options.Bucket, &clientOptions.Bucket},
+		{options.Database, &clientOptions.Database},
+		{options.Username, &clientOptions.Username},
+		{options.Password, &clientOptions.Password},
+	} {
+		if len(option.value) > 0 {
+			*option.target = option.value
+		}
+	}
+
+	bucket := clientOptions.Bucket
+	if clientOptions.APIVersion == APIv1 {
+		bucket = clientOptions.Database
+	}
+
+	rep := &replica{
+		url:     clientOptions.ServerURL,
+		options: clientOptions,
+		bucket:  bucket,
+		routes:  make(map[string]*route),
+		pending: make(chan *replicaJob, writerOptions.Writer.ReplicaMaxPending),
+		done:    make(chan struct{}),
+	}
+
+	rep.routeOf = rep.route
+
+	if len(writerOptions.Queue.Dir) > 0 {
+		q, err := queue.New(&queue.Options{
+			Dir:     filepath.Join(writerOptions.Queue.Dir, replicaDir(rep.url, bucket)),
+			MaxSize: writerOptions.Queue.MaxSize,
+		})
+		if err != nil {
+			w.log(LevelError, "queue.new", Field{"server", rep.url}, Field{"error", err})
+			w.reportError(&WriteError{Err: err, ServerURL: rep.url})
+		} else {
+			rep.queue = q
+		}
+	}
+
+	return rep
+}
+
+// newPrimary returns the primary server as a replica, which uses the routes,
+// the durable queue and the stats of the writer.
+func (w *writer) newPrimary(writerOptions *Options) *replica {
+	return &replica{
+		url:     w.clientOptions.ServerURL,
+		primary: true,
+		routeOf: w.route,
+		pending: make(chan *replicaJob, writerOptions.Writer.ReplicaMaxPending),
+		queue:   w.queue,
+		done:    make(chan struct{}),
+	}
+}
+
+// replicaDir names the durable queue directory of the replica after its
+// server and bucket, so that segments stay with their server when replicas
+// are reordered.
+func replicaDir(url, bucket string) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(url + "\n" + bucket))
+
+	return fmt.Sprintf("replica-%016x", hash.Sum64())
+}
+
+// route returns the route of the bucket on the replica, an empty bucket
+// selects the default bucket of the replica.
+func (rep *replica) route(bucket string) *route {
+	if len(bucket) == 0 {
+		bucket = rep.bucket
+	}
+
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	if r, ok := rep.routes[bucket]; ok {
+		return r
+	}
+
+	options := rep.options
+	if options.APIVersion == APIv1 {
+		options.Database = bucket
+	} else {
+		options.Bucket = bucket
+	}
+
+	r := &route{
+		bucket:  bucket,
+		client:  client.New(&options),
+		replica: rep,
+	}
+
+	rep.routes[bucket] = r
+
+	return r
+}
+
+func (rep *replica) park(ids ...string) {
+	rep.lock.Lock()
+	rep.parked = append(rep.parked, ids...)
+	rep.lock.Unlock()
+}
+
+// takeParked returns the parked segments, unless they are backing off.
+func (rep *replica) takeParked() []string {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	if time.Now().Before(rep.retryAt) {
+		return nil
+	}
+
+	parked := rep.parked
+	rep.parked = nil
+
+	return parked
+}
+
+// repark parks the segments which failed temporarily again, before the ones
+// parked meanwhile, and backs off. The backoff is reset when all the segments
+// were delivered or dropped.
+func (rep *replica) repark(failed []string, options *retry.Options) {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+
+	if len(failed) == 0 {
+		rep.delay = 0
+
+		return
+	}
+
+	rep.parked = append(failed, rep.parked...)
+
+	if rep.delay == 0 {
+		rep.delay = options.InitialBackoff
+	} else {
+		rep.delay *= 2
+	}
+
+	if options.MaxBackoff > 0 && rep.delay > options.MaxBackoff {
+		rep.delay = options.MaxBackoff
+	}
+
+	rep.retryAt = time.Now().Add(rep.delay)
+}
+
+// servers returns the primary server and the replicas.
+func (w *writer) servers() []*replica {
+	if w.primary == nil {
+		return nil
+	}
+
+	return append([]*replica{w.primary}, w.replicas...)
+}
+
+// fanOut hands the batch to every server without waiting for delivery. The
+// tracker learns about the batch from the primary server.
+func (w *writer) fanOut(j *job) {
+	defer j.batch.Reset()
+
+	data, entries, err := w.read(j.batch)
+	if err != nil || len(data) == 0 {
+		w.tracker.done(j.seq, errorOf(err))
+
+		return
+	}
+
+	bucket := ""
+	if j.route != nil {
+		bucket = j.route.bucket
+	}
+
+	// The primary server is the last one, as it may block.
+	for _, rep := range w.replicas {
+		w.replicate(rep, &replicaJob{bucket: bucket, data: data, entries: entries})
+	}
+
+	w.replicate(w.primary, &replicaJob{bucket: bucket, data: data, entries: entries, seq: j.seq})
+}
+
+// replicate hands the batch to the server. When the server has too many
+// pending batches, the batch is parked in its durable queue. Without one, the
+// primary server waits for a pending batch to be taken, as a writer without
+// replicas does, and a replica drops the batch.
+func (w *writer) replicate(rep *replica, j *replicaJob) {
+	select {
+	case rep.pending <- j:
+		return
+	default:
+	}
+
+	r := rep.routeOf(j.bucket)
+
+	if rep.queue != nil {
+		segment := j.data
+		if len(j.bucket) > 0 {
+			segment = markBucket(j.bucket, j.data)
+		}
+
+		id, err := rep.queue.Put(segment)
+		if err == nil {
+			rep.park(id)
+
+			w.log(LevelWarn, "server: parked", Field{"segment", id}, Field{"server", rep.url})
+
+			if rep.primary {
+				w.tracker.done(j.seq, nil)
+			}
+
+			return
+		}
+
+		w.log(LevelError, "queue.put", Field{"server", rep.url}, Field{"error", err})
+	}
+
+	if rep.primary {
+		rep.pending <- j
+
+		return
+	}
+
+	writeErr := &WriteError{
+		Err:       ErrReplicaFull,
+		Size:      uint64(len(j.data)),
+		Entries:   j.entries,
+		Bucket:    r.bucket,
+		ServerURL: rep.url,
+		Dropped:   true,
+	}
+
+	atomic.AddUint64(&rep.stats.batchesFailed, 1)
+	w.reportRouteError(r, writeErr)
+
+	w.log(LevelError, "server: dropped",
+		Field{"size", len(j.data)}, Field{"entries", j.entries}, Field{"server", rep.url})
+
+	w.bury(j.data, writeErr)
+}
+
+// serve delivers the pending batches of the server with the given number of
+// senders. The segments left in its durable queue by the previous run are
+// parked, so that the senders deliver them next to the pending batches.
+func (w *writer) serve(rep *replica, segments []string, concurrency uint) {
+	defer close(rep.done)
+
+	rep.park(segments...)
+
+	wg := sync.WaitGroup{}
+
+	for i := uint(0); i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			w.replicaSender(rep)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *writer) replicaSender(rep *replica) {
+	ticker := time.NewTicker(w.sendInterval)
+	defer ticker.Stop()
+
+	w.unpark(rep)
+
+	for {
+		select {
+		case j, ok := <-rep.pending:
+			if !ok {
+				w.unpark(rep)
+
+				return
+			}
+
+			id, err := w.deliverQueued(rep.queue, j.bucket, rep.routeOf(j.bucket), j.data, j.entries)
+			if len(id) > 0 {
+				rep.repark([]string{id}, w.retry)
+			}
+
+			if rep.primary {
+				w.tracker.done(j.seq, errorOf(err))
+			}
+		case <-ticker.C:
+		}
+
+		w.unpark(rep)
+	}
+}
+
+// unpark delivers the parked segments. The segments which fail temporarily
+// are retried with backoff until they are delivered or dropped, and stay in
+// the durable queue for the next start when the writer is closed meanwhile.
+func (w *writer) unpark(rep *replica) {
+	if rep.queue == nil || w.aborted() {
+		return
+	}
+
+	ids := rep.takeParked()
+	if len(ids) == 0 {
+		return
+	}
+
+	rep.repark(w.replaySegments(rep.queue, ids, rep.routeOf), w.retry)
+}
+
+// errorOf keeps a nil *WriteError from becoming a non-nil error.
+func errorOf(err *WriteError) error {
+	if err == nil {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,331 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Write_Replica(t *testing.T) {
+	primary := newBucketServer()
+	defer primary.Close()
+
+	replica := newBucketServer()
+	defer replica.Close()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(primary.URL).
+		SetOrg("org").
+		SetLogger(&mockLogger{}).
+		AddReplica(Replica{
+			ServerURL: replica.URL,
+			Bucket:    "copy",
+		}))
+
+	testWriter.WriteLine("cpu value=1")
+	testWriter.WriteToBucket("audit", []byte("audit value=1"))
+	assert.Nil(t, testWriter.Flush(context.Background()))
+	testWriter.Close()
+
+	assert.Equal(t, map[string]string{
+		"test":  "cpu value=1\n",
+		"audit": "audit value=1\n",
+	}, primary.received)
+	assert.Equal(t, map[string]string{
+		"copy":  "cpu value=1\n",
+		"audit": "audit value=1\n",
+	}, replica.received)
+	stats := testWriter.Stats()
+	assert.Equal(t, uint64(2), stats.BatchesSent)
+	assert.Equal(t, uint64(2), stats.EntriesSent)
+	assert.Len(t, stats.Replicas, 1)
+	assert.Equal(t, replica.URL, stats.Replicas[0].ServerURL)
+	assert.Equal(t, uint64(2), stats.Replicas[0].BatchesSent)
+	assert.Equal(t, uint64(2), stats.Replicas[0].EntriesSent)
+}
+
+func Test_replicaDir(t *testing.T) {
+	assert.Equal(t, replicaDir("http://a:8086", "test"), replicaDir("http://a:8086", "test"))
+	assert.NotEqual(t, replicaDir("http://a:8086", "test"), replicaDir("http://b:8086", "test"))
+	assert.NotEqual(t, replicaDir("http://a:8086", "test"), replicaDir("http://a:8086", "copy"))
+	assert.Regexp(t, "^replica-[0-9a-f]{16}$", replicaDir("http://a:8086", "test"))
+}
+
+// blockingServer blocks the first request until it is released, the other
+// requests are answered right away.
+type blockingServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	received []string
+	first    chan struct{}
+	release  chan struct{}
+	blocked  bool
+}
+
+func newBlockingServer() *blockingServer {
+	s := &blockingServer{
+		first:   make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		block := !s.blocked
+		s.blocked = true
+		s.lock.Unlock()
+
+		if block {
+			close(s.first)
+			<-s.release
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+
+		s.lock.Lock()
+		s.received = append(s.received, string(data))
+		s.lock.Unlock()
+
+		w.WriteHeader(204)
+	}))
+
+	return s
+}
+
+func Test_Write_Replica_Outage(t *testing.T) {
+	for _, durable := range []bool{false, true} {
+		primary := newBucketServer()
+		replica := newBlockingServer()
+
+		writeErrors := make([]*WriteError, 0)
+		lock := sync.Mutex{}
+		logger := &mockLogger{}
+		dir := t.TempDir()
+
+		options := DefaultOptions().
+			SetServerURL(primary.URL).
+			SetOrg("org").
+			SetLogger(logger).
+			SetReplicaMaxPending(1).
+			SetErrorHandler(func(err *WriteError) {
+				lock.Lock()
+				writeErrors = append(writeErrors, err)
+				lock.Unlock()
+			}).
+			AddReplica(Replica{ServerURL: replica.URL})
+
+		if durable {
+			options.SetQueueDir(dir)
+		}
+
+		testWriter := NewWriterWithOptions(options)
+
+		testWriter.WriteLine("cpu value=1")
+		assert.Nil(t, testWriter.Flush(context.Background()))
+		<-replica.first
+
+		testWriter.WriteLine("cpu value=2")
+		assert.Nil(t, testWriter.Flush(context.Background()))
+		testWriter.WriteLine("cpu value=3")
+		assert.Nil(t, testWriter.Flush(context.Background()))
+
+		assert.Equal(t, map[string]string{"test": "cpu value=1\ncpu value=2\ncpu value=3\n"}, primary.received)
+
+		close(replica.release)
+		testWriter.Close()
+
+		if durable {
+			assert.ElementsMatch(t, []string{"cpu value=1\n", "cpu value=2\n", "cpu value=3\n"}, replica.received)
+			assert.Empty(t, writeErrors)
+
+			parked := 0
+			for _, line := range logger.Lines {
+				if strings.HasPrefix(line, "WARN server: parked: ") &&
+					strings.HasSuffix(line, "server: "+replica.URL) {
+					parked++
+				}
+			}
+			assert.Equal(t, 1, parked)
+
+			files, err := ioutil.ReadDir(filepath.Join(dir, replicaDir(replica.URL, "test")))
+			assert.Nil(t, err)
+			assert.Empty(t, files)
+		} else {
+			assert.Equal(t, []string{"cpu value=1\n", "cpu value=2\n"}, replica.received)
+			assert.Len(t, writeErrors, 1)
+			assert.True(t, errors.Is(writeErrors[0], ErrReplicaFull))
+			assert.Equal(t, replica.URL, writeErrors[0].ServerURL)
+			assert.Equal(t, "test", writeErrors[0].Bucket)
+			assert.True(t, writeErrors[0].Dropped)
+		}
+
+		primary.Close()
+		replica.Close()
+	}
+}
+
+func Test_Write_Replica_PrimaryOutage(t *testing.T) {
+	for _, durable := range []bool{false, true} {
+		primary := newBlockingServer()
+		replica := newBlockingServer()
+		close(replica.release)
+
+		writeErrors := make([]*WriteError, 0)
+		lock := sync.Mutex{}
+
+		options := DefaultOptions().
+			SetServerURL(primary.URL).
+			SetOrg("org").
+			SetLogger(&mockLogger{}).
+			SetEntriesLimit(2).
+			SetReplicaMaxPending(1).
+			SetErrorHandler(func(err *WriteError) {
+				lock.Lock()
+				writeErrors = append(writeErrors, err)
+				lock.Unlock()
+			}).
+			AddReplica(Replica{ServerURL: replica.URL})
+
+		if durable {
+			options.SetQueueDir(t.TempDir())
+		}
+
+		testWriter := NewWriterWithOptions(options)
+
+		received := func(s *blockingServer) int {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			return len(s.received)
+		}
+
+		written := make(chan struct{})
+
+		// A batch of one line is handed off when the next line is written.
+		go func() {
+			for i := 1; i <= 5; i++ {
+				testWriter.WriteLine(fmt.Sprintf("cpu value=%d", i))
+			}
+			close(written)
+		}()
+
+		<-primary.first
+
+		// With a durable queue, the batches of the primary server are parked
+		// and the replica keeps receiving them, without one, the writes wait
+		// for the primary server.
+		if durable {
+			<-written
+
+			assert.Eventually(t, func() bool {
+				return received(replica) == 4
+			}, 5*time.Second, time.Millisecond)
+		}
+
+		close(primary.release)
+		<-written
+
+		// The primary server loses nothing, the replica may drop the batches
+		// without a durable queue.
+		result, err := testWriter.Shutdown(context.Background())
+		assert.Equal(t, uint64(5), result.Delivered)
+		assert.Equal(t, uint64(0), result.Lost)
+		assert.ElementsMatch(t, []string{
+			"cpu value=1\n", "cpu value=2\n", "cpu value=3\n", "cpu value=4\n", "cpu value=5\n",
+		}, primary.received)
+
+		for _, writeErr := range writeErrors {
+			assert.True(t, errors.Is(writeErr, ErrReplicaFull))
+			assert.Equal(t, replica.URL, writeErr.ServerURL)
+		}
+
+		if durable {
+			assert.Nil(t, err)
+			assert.Equal(t, []ReplicaResult{{ServerURL: replica.URL, Delivered: 5}}, result.Replicas)
+			assert.Len(t, replica.received, 5)
+			assert.Empty(t, writeErrors)
+		} else {
+			assert.Len(t, result.Replicas, 1)
+			assert.Equal(t, uint64(5), result.Replicas[0].Delivered+result.Replicas[0].Lost)
+			assert.Equal(t, result.Replicas[0].Lost > 0, err != nil)
+		}
+
+		primary.Close()
+		replica.Close()
+	}
+}
+
+func Test_Write_Replica_Retry(t *testing.T) {
+	primary := newBucketServer()
+	defer primary.Close()
+
+	lock := sync.Mutex{}
+	healthy := false
+	received := make([]string, 0)
+
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if !healthy {
+			w.WriteHeader(503)
+
+			return
+		}
+
+		received = append(received, string(data))
+		w.WriteHeader(204)
+	}))
+	defer replica.Close()
+
+	dir := t.TempDir()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(primary.URL).
+		SetOrg("org").
+		SetLogger(&mockLogger{}).
+		SetSendInterval(10 * time.Millisecond).
+		SetRetryMaxAttempts(1).
+		SetRetryInitialBackoff(10 * time.Millisecond).
+		SetQueueDir(dir).
+		AddReplica(Replica{ServerURL: replica.URL}))
+
+	testWriter.WriteLine("cpu value=1")
+	assert.Nil(t, testWriter.Flush(context.Background()))
+
+	// The failed batch stays in the durable queue and is retried while the
+	// writer runs.
+	assert.Eventually(t, func() bool {
+		return testWriter.Stats().Replicas[0].BatchesFailed > 1
+	}, 5*time.Second, time.Millisecond)
+
+	lock.Lock()
+	healthy = true
+	lock.Unlock()
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return len(received) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	result, err := testWriter.Shutdown(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []ReplicaResult{{ServerURL: replica.URL, Delivered: 1}}, result.Replicas)
+	assert.Equal(t, []string{"cpu value=1\n"}, received)
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, replicaDir(replica.URL, "test")))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,159 @@
+package writer
+
+import (
+	"bytes"
+
+	"github.com/a-kataev/go-influxdb-writer/internal/batch"
+	"github.com/a-kataev/go-influxdb-writer/internal/client"
+	"github.com/a-kataev/go-influxdb-writer/internal/lineprotocol"
+)
+
+// Router returns the bucket for the measurement of a line or a point, an
+// empty bucket selects the default one.
+type Router func(measurement string) string
+
+// bucketMarker starts a comment line, which sets the bucket of the following
+// lines in spill files, queue segments and dead letter files.
+var bucketMarker = []byte("#bucket ")
+
+// route is a bucket other than the default one, or a bucket of a replica. It
+// keeps its own batch, its client shares the HTTP client of the writer.
+type route struct {
+	bucket  string
+	client  client.Client
+	batch   batch.Batch
+	replica *replica
+}
+
+// fields adds the server of a replica to the log fields.
+func (r *route) fields(fields ...Field) []Field {
+	if r == nil || r.replica == nil {
+		return fields
+	}
+
+	return append(fields, Field{"server", r.replica.url})
+}
+
+// route returns the route of the bucket, creating it on first use, or nil
+// for the default bucket.
+func (w *writer) route(bucket string) *route {
+	if len(bucket) == 0 || bucket == w.bucket {
+		return nil
+	}
+
+	w.routesLock.Lock()
+	defer w.routesLock.Unlock()
+
+	if r, ok := w.routes[bucket]; ok {
+		return r
+	}
+
+	options := *w.clientOptions
+	if options.APIVersion == APIv1 {
+		options.Database = bucket
+	} else {
+		options.Bucket = bucket
+	}
+
+	r := &route{
+		bucket: bucket,
+		client: client.New(&options),
+		batch:  batch.New(w.batchOptions),
+	}
+
+	if w.routes == nil {
+		w.routes = make(map[string]*route)
+	}
+
+	w.routes[bucket] = r
+
+	w.log(LevelInfo, "route", Field{"bucket", bucket})
+
+	return r
+}
+
+func (w *writer) routeOf(e entry) *route {
+	bucket := e.bucket
+
+	if len(bucket) == 0 && w.router != nil {
+		if e.point != nil {
+			bucket = w.router(e.point.measurement)
+		} else {
+			bucket = w.router(lineprotocol.Measurement(e.line))
+		}
+	}
+
+	return w.route(bucket)
+}
+
+func (w *writer) routeList() []*route {
+	w.routesLock.Lock()
+	defer w.routesLock.Unlock()
+
+	routes := make([]*route, 0, len(w.routes))
+	for _, r := range w.routes {
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
+// target returns the client and the bucket of the route.
+func (w *writer) target(r *route) (client.Client, string) {
+	if r == nil {
+		return w.client, w.bucket
+	}
+
+	return r.client, r.bucket
+}
+
+func (w *writer) batchOf(r *route) batch.Batch {
+	if r == nil {
+		return w.batch
+	}
+
+	return r.batch
+}
+
+func (w *writer) setBatch(r *route, b batch.Batch) {
+	if r == nil {
+		w.batch = b
+	} else {
+		r.batch = b
+	}
+}
+
+// buffer updates the stats with the fill of the batches being written.
+func (w *writer) buffer() {
+	size, entries := w.batch.Size(), w.batch.Entries()
+
+	for _, r := range w.routeList() {
+		size += r.batch.Size()
+		entries += r.batch.Entries()
+	}
+
+	w.stats.buffer(size, entries)
+}
+
+func markBucket(bucket string, data []byte) []byte {
+	marked := make([]byte, 0, len(bucketMarker)+len(bucket)+1+len(data))
+	marked = append(marked, bucketMarker...)
+	marked = append(marked, bucket...)
+	marked = append(marked, '\n')
+
+	return append(marked, data...)
+}
+
+// unmarkBucket splits the bucket marker off the data.
+func unmarkBucket(data []byte) (string, []byte) {
+	if !bytes.HasPrefix(data, bucketMarker) {
+		return "", data
+	}
+
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return string(data[len(bucketMarker):]), nil
+	}
+
+	return string(data[len(bucketMarker):i]), data[i+1:]
+}
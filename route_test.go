@@ -0,0 +1,142 @@
+package writer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/a-kataev/go-influxdb-writer/internal/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_unmarkBucket(t *testing.T) {
+	bucket, data := unmarkBucket(markBucket("audit", []byte("cpu value=1\n")))
+	assert.Equal(t, "audit", bucket)
+	assert.Equal(t, []byte("cpu value=1\n"), data)
+
+	bucket, data = unmarkBucket([]byte("cpu value=1\n"))
+	assert.Equal(t, "", bucket)
+	assert.Equal(t, []byte("cpu value=1\n"), data)
+
+	bucket, data = unmarkBucket([]byte("#bucket audit"))
+	assert.Equal(t, "audit", bucket)
+	assert.Empty(t, data)
+}
+
+type bucketServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	received map[string]string
+}
+
+func newBucketServer() *bucketServer {
+	s := &bucketServer{received: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+
+		s.lock.Lock()
+		s.received[r.URL.Query().Get("bucket")] += string(data)
+		s.lock.Unlock()
+
+		w.WriteHeader(204)
+	}))
+
+	return s
+}
+
+func Test_Write_Route(t *testing.T) {
+	server := newBucketServer()
+	defer server.Close()
+
+	logger := &mockLogger{}
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetOrg("org").
+		SetLogger(logger).
+		SetQueueDir(t.TempDir()).
+		SetRouter(func(measurement string) string {
+			if measurement == "audit log" {
+				return "audit"
+			}
+
+			return ""
+		}))
+
+	testWriter.WriteLine("cpu value=1")
+	testWriter.WriteLine(`audit\ log value=1`)
+	testWriter.WriteToBucket("rollups", []byte("cpu value=2"))
+	testWriter.WritePointToBucket("rollups", NewPoint("cpu").AddIntField("value", 3))
+	testWriter.WritePoint(NewPoint("audit log").AddIntField("value", 2))
+	testWriter.WriteToBucket("test", []byte("cpu value=4"))
+
+	assert.Nil(t, testWriter.Flush(context.Background()))
+	assert.Equal(t, map[string]string{
+		"test":    "cpu value=1\ncpu value=4\n",
+		"audit":   "audit\\ log value=1\naudit\\ log value=2i\n",
+		"rollups": "cpu value=2\ncpu value=3i\n",
+	}, server.received)
+
+	testWriter.WriteToBucket("rollups", []byte("cpu value=5"))
+	testWriter.Close()
+
+	assert.Equal(t, "cpu value=2\ncpu value=3i\ncpu value=5\n", server.received["rollups"])
+	assert.ElementsMatch(t, []string{"started", "route: bucket: audit", "route: bucket: rollups", "stopped"},
+		logger.InfoLines)
+}
+
+func Test_replay_Route(t *testing.T) {
+	server := newBucketServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	testQueue, err := queue.New(&queue.Options{Dir: dir})
+	assert.Nil(t, err)
+
+	_, err = testQueue.Put(markBucket("audit", []byte("audit value=1\n")))
+	assert.Nil(t, err)
+	_, err = testQueue.Put([]byte("cpu value=1\n"))
+	assert.Nil(t, err)
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetOrg("org").
+		SetLogger(&mockLogger{}).
+		SetQueueDir(dir))
+	testWriter.Close()
+
+	assert.Equal(t, map[string]string{
+		"audit": "audit value=1\n",
+		"test":  "cpu value=1\n",
+	}, server.received)
+}
+
+func Test_Write_Route_Spill(t *testing.T) {
+	server := newBucketServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	s, err := newSpill(dir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, s.put("audit", []byte("audit value=1")))
+	assert.Nil(t, s.put("", []byte("cpu value=1")))
+	assert.Nil(t, s.close())
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetOrg("org").
+		SetLogger(&mockLogger{}).
+		SetOverflowPolicy(OverflowSpill).
+		SetSpillDir(dir))
+	testWriter.Close()
+
+	assert.Equal(t, map[string]string{
+		"audit": "audit value=1\n",
+		"test":  "cpu value=1\n",
+	}, server.received)
+}
@@ -0,0 +1,35 @@
+//go:build go1.21
+
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_slogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	logger.Log(LevelDebug, "send batch", Field{"request_id", "id"}, Field{"size", 10})
+	logger.Log(LevelInfo, "started")
+	logger.Log(LevelWarn, "send batch: retry", Field{"status_code", 503})
+	logger.Log(LevelError, "client.send", Field{"error", errors.New("test")})
+
+	assert.Equal(t, "level=DEBUG msg=\"send batch\" request_id=id size=10\n"+
+		"level=INFO msg=started\n"+
+		"level=WARN msg=\"send batch: retry\" status_code=503\n"+
+		"level=ERROR msg=client.send error=test\n", buf.String())
+}
@@ -0,0 +1,182 @@
+package writer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	spillName      = "spill.lp"
+	spillTakenName = "spill.taken.lp"
+	// spillCloseAttempts bounds the unspilling on close: the taken file and
+	// the spill file take two attempts, the third one retries a failure.
+	spillCloseAttempts = 3
+)
+
+// spill keeps lines that did not fit into the input queue in a file, the
+// writer takes them back when the input queue drains.
+type spill struct {
+	lock    sync.Mutex
+	dir     string
+	file    *os.File
+	size    uint64
+	maxSize uint64
+	taken   bool
+	bucket  string
+}
+
+func newSpill(dir string, maxSize uint64) (*spill, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &spill{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, spillTakenName)); err == nil {
+		s.taken = true
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *spill) open() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, spillName),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = uint64(info.Size())
+	s.bucket = ""
+
+	if s.size > 0 {
+		// The bucket of the last line is unknown, so the next line is marked.
+		s.bucket = "\n"
+	}
+
+	return nil
+}
+
+// put appends the line, preceded by a bucket marker when the bucket differs
+// from the bucket of the previous line.
+func (s *spill) put(bucket string, line []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	data := make([]byte, 0, len(bucketMarker)+len(bucket)+len(line)+2)
+
+	if bucket != s.bucket {
+		data = append(data, bucketMarker...)
+		data = append(data, bucket...)
+		data = append(data, '\n')
+	}
+
+	data = append(data, line...)
+	data = append(data, '\n')
+
+	size := uint64(len(data))
+	if s.maxSize > 0 && s.size+size > s.maxSize {
+		return ErrSpillFull
+	}
+
+	if _, err := s.file.Write(data); err != nil {
+		return err
+	}
+
+	s.size += size
+	s.bucket = bucket
+
+	return nil
+}
+
+func (s *spill) pending() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.taken || s.size > 0
+}
+
+// take returns the path of a file with spilled lines, which must be released
+// after it is read, or an empty path if nothing was spilled. Until then, the
+// same file is returned again, so that lines are not lost when it could not
+// be read.
+func (s *spill) take() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	taken := filepath.Join(s.dir, spillTakenName)
+
+	if s.taken {
+		return taken, nil
+	}
+
+	if s.size == 0 || s.file == nil {
+		return "", nil
+	}
+
+	if err := s.file.Close(); err != nil {
+		return "", err
+	}
+
+	s.file = nil
+
+	if err := os.Rename(filepath.Join(s.dir, spillName), taken); err != nil {
+		_ = s.open()
+		return "", err
+	}
+
+	s.taken = true
+
+	if err := s.open(); err != nil {
+		return "", err
+	}
+
+	return taken, nil
+}
+
+// release removes the file returned by take after it was read.
+func (s *spill) release() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.Remove(filepath.Join(s.dir, spillTakenName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.taken = false
+
+	return nil
+}
+
+func (s *spill) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,91 @@
+package writer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_spill(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newSpill(dir, 16)
+	assert.Nil(t, err)
+	assert.False(t, s.pending())
+
+	path, err := s.take()
+	assert.Nil(t, err)
+	assert.Equal(t, "", path)
+
+	assert.Nil(t, s.put("", []byte("cpu v=1")))
+	assert.Nil(t, s.put("", []byte("cpu v=2")))
+	assert.Equal(t, ErrSpillFull, s.put("", []byte("cpu v=3")))
+	assert.True(t, s.pending())
+
+	path, err = s.take()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, spillTakenName), path)
+	assert.True(t, s.pending())
+
+	assert.Nil(t, s.put("", []byte("cpu v=3")))
+
+	path, err = s.take()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, spillTakenName), path)
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "cpu v=1\ncpu v=2\n", string(data))
+	assert.Nil(t, s.close())
+	assert.Equal(t, os.ErrClosed, s.put("", []byte("cpu v=4")))
+
+	s, err = newSpill(dir, 0)
+	assert.Nil(t, err)
+	assert.True(t, s.pending())
+
+	path, err = s.take()
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, spillTakenName), path)
+	assert.Nil(t, s.release())
+
+	path, err = s.take()
+	assert.Nil(t, err)
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "cpu v=3\n", string(data))
+	assert.Nil(t, s.release())
+	assert.False(t, s.pending())
+	assert.Nil(t, s.release())
+
+	assert.Nil(t, s.put("a", []byte("cpu v=4")))
+	assert.Nil(t, s.put("a", []byte("cpu v=5")))
+	assert.Nil(t, s.put("", []byte("cpu v=6")))
+	assert.Nil(t, s.close())
+
+	s, err = newSpill(dir, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, s.put("", []byte("cpu v=7")))
+
+	path, err = s.take()
+	assert.Nil(t, err)
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "#bucket a\ncpu v=4\ncpu v=5\n#bucket \ncpu v=6\n#bucket \ncpu v=7\n", string(data))
+	assert.Nil(t, s.close())
+}
+
+func Test_OverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSpill} {
+		parsed, err := ParseOverflowPolicy(policy.String())
+		assert.Nil(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := ParseOverflowPolicy("test")
+	assert.EqualError(t, err, "unknown overflow policy: test")
+
+	assert.Equal(t, "overflow(10)", OverflowPolicy(10).String())
+}
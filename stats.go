@@ -0,0 +1,169 @@
+package writer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var latencyBuckets = [...]time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// LatencyHistogram holds cumulative counts of send requests per bucket, the
+// last bucket has no upper bound.
+type LatencyHistogram struct {
+	Buckets []LatencyBucket
+	Count   uint64
+	Sum     time.Duration
+}
+
+// Stats is a snapshot of the writer counters. The counters are read one by
+// one, so the snapshot is not consistent across fields while data is written.
+type Stats struct {
+	LinesAccepted  uint64
+	LinesRejected  uint64
+	BatchesSent    uint64
+	BatchesFailed  uint64
+	BytesSent      uint64
+	EntriesSent    uint64
+	Retries        uint64
+	DroppedEntries uint64
+	// LinesOverflowed counts the lines dropped by the overflow policy, they
+	// are included in DroppedEntries too.
+	LinesOverflowed  uint64
+	LinesSpilled     uint64
+	InputQueueLength uint64
+	BufferSize       uint64
+	BufferEntries    uint64
+	PendingBatches   uint64
+	LastError        *WriteError
+	LastErrorTime    time.Time
+	SendLatency      LatencyHistogram
+	// Replicas holds the delivery counters of the replicas, the counters
+	// above are of the primary server.
+	Replicas []ReplicaStats
+}
+
+type ReplicaStats struct {
+	ServerURL      string
+	BatchesSent    uint64
+	BatchesFailed  uint64
+	BytesSent      uint64
+	EntriesSent    uint64
+	LinesRejected  uint64
+	Retries        uint64
+	DroppedEntries uint64
+	PendingBatches uint64
+	LastError      *WriteError
+	LastErrorTime  time.Time
+}
+
+type lastError struct {
+	err  *WriteError
+	time time.Time
+}
+
+// stats must be the first field of the writer, so that 64-bit atomic
+// operations are aligned on 32-bit platforms.
+type stats struct {
+	linesAccepted   uint64
+	linesRejected   uint64
+	batchesSent     uint64
+	batchesFailed   uint64
+	bytesSent       uint64
+	entriesSent     uint64
+	retries         uint64
+	droppedEntries  uint64
+	linesOverflowed uint64
+	linesSpilled    uint64
+	bufferSize      uint64
+	bufferEntries   uint64
+	latencyCount    uint64
+	latencySum      uint64
+	latency         [len(latencyBuckets) + 1]uint64
+	lastError       atomic.Value
+}
+
+func (s *stats) error(err *WriteError) {
+	if err.Retry {
+		atomic.AddUint64(&s.retries, 1)
+	}
+
+	if err.Dropped {
+		atomic.AddUint64(&s.droppedEntries, err.Entries)
+	}
+
+	s.lastError.Store(lastError{err: err, time: time.Now()})
+}
+
+func (s *stats) buffer(size, entries uint64) {
+	atomic.StoreUint64(&s.bufferSize, size)
+	atomic.StoreUint64(&s.bufferEntries, entries)
+}
+
+func (s *stats) sent(size int, entries uint64) {
+	atomic.AddUint64(&s.batchesSent, 1)
+	atomic.AddUint64(&s.bytesSent, uint64(size))
+	atomic.AddUint64(&s.entriesSent, entries)
+}
+
+func (s *stats) observe(latency time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && latency > latencyBuckets[i] {
+		i++
+	}
+
+	atomic.AddUint64(&s.latency[i], 1)
+	atomic.AddUint64(&s.latencySum, uint64(latency))
+	atomic.AddUint64(&s.latencyCount, 1)
+}
+
+func (s *stats) snapshot() Stats {
+	snapshot := Stats{
+		LinesAccepted:   atomic.LoadUint64(&s.linesAccepted),
+		LinesRejected:   atomic.LoadUint64(&s.linesRejected),
+		BatchesSent:     atomic.LoadUint64(&s.batchesSent),
+		BatchesFailed:   atomic.LoadUint64(&s.batchesFailed),
+		BytesSent:       atomic.LoadUint64(&s.bytesSent),
+		EntriesSent:     atomic.LoadUint64(&s.entriesSent),
+		Retries:         atomic.LoadUint64(&s.retries),
+		DroppedEntries:  atomic.LoadUint64(&s.droppedEntries),
+		LinesOverflowed: atomic.LoadUint64(&s.linesOverflowed),
+		LinesSpilled:    atomic.LoadUint64(&s.linesSpilled),
+		BufferSize:      atomic.LoadUint64(&s.bufferSize),
+		BufferEntries:   atomic.LoadUint64(&s.bufferEntries),
+		SendLatency: LatencyHistogram{
+			Buckets: make([]LatencyBucket, len(latencyBuckets)),
+			Count:   atomic.LoadUint64(&s.latencyCount),
+			Sum:     time.Duration(atomic.LoadUint64(&s.latencySum)),
+		},
+	}
+
+	count := uint64(0)
+	for i, bound := range latencyBuckets {
+		count += atomic.LoadUint64(&s.latency[i])
+		snapshot.SendLatency.Buckets[i] = LatencyBucket{UpperBound: bound, Count: count}
+	}
+
+	if last, ok := s.lastError.Load().(lastError); ok {
+		snapshot.LastError = last.err
+		snapshot.LastErrorTime = last.time
+	}
+
+	return snapshot
+}
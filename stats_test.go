@@ -0,0 +1,103 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stats(t *testing.T) {
+	s := &stats{}
+
+	snapshot := s.snapshot()
+	assert.Nil(t, snapshot.LastError)
+	assert.Len(t, snapshot.SendLatency.Buckets, len(latencyBuckets))
+
+	s.observe(time.Millisecond)
+	s.observe(5 * time.Millisecond)
+	s.observe(30 * time.Millisecond)
+	s.observe(time.Minute)
+
+	retryErr := &WriteError{Err: errors.New("retry"), Entries: 2, Retry: true}
+	dropErr := &WriteError{Err: errors.New("drop"), Entries: 3, Dropped: true}
+
+	s.error(retryErr)
+	s.error(dropErr)
+	s.buffer(10, 2)
+	s.sent(100, 2)
+
+	snapshot = s.snapshot()
+	assert.Equal(t, uint64(1), snapshot.Retries)
+	assert.Equal(t, uint64(3), snapshot.DroppedEntries)
+	assert.Equal(t, dropErr, snapshot.LastError)
+	assert.False(t, snapshot.LastErrorTime.IsZero())
+	assert.Equal(t, uint64(10), snapshot.BufferSize)
+	assert.Equal(t, uint64(2), snapshot.BufferEntries)
+	assert.Equal(t, uint64(1), snapshot.BatchesSent)
+	assert.Equal(t, uint64(100), snapshot.BytesSent)
+	assert.Equal(t, uint64(2), snapshot.EntriesSent)
+
+	assert.Equal(t, uint64(4), snapshot.SendLatency.Count)
+	assert.Equal(t, time.Minute+36*time.Millisecond, snapshot.SendLatency.Sum)
+	assert.Equal(t, LatencyBucket{UpperBound: 5 * time.Millisecond, Count: 2},
+		snapshot.SendLatency.Buckets[0])
+	assert.Equal(t, LatencyBucket{UpperBound: 25 * time.Millisecond, Count: 2},
+		snapshot.SendLatency.Buckets[2])
+	assert.Equal(t, LatencyBucket{UpperBound: 50 * time.Millisecond, Count: 3},
+		snapshot.SendLatency.Buckets[3])
+	assert.Equal(t, LatencyBucket{UpperBound: 10 * time.Second, Count: 3},
+		snapshot.SendLatency.Buckets[len(latencyBuckets)-1])
+}
+
+func Test_Stats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(data), "fail") {
+			w.WriteHeader(400)
+			return
+		}
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&mockLogger{}).
+		SetSendInterval(time.Hour).
+		SetValidateLines(true).
+		SetRetryMaxAttempts(1))
+	defer testWriter.Close()
+
+	testWriter.WriteLine("a v=1")
+	testWriter.WriteLine("bad")
+	testWriter.WriteLine("a v=2")
+	assert.Nil(t, testWriter.Flush(context.Background()))
+
+	testWriter.WriteLine("fail v=1")
+	assert.NotNil(t, testWriter.Flush(context.Background()))
+
+	testWriter.WriteLine("a v=3")
+	assert.Eventually(t, func() bool {
+		return testWriter.Stats().BufferEntries == 1
+	}, time.Second, time.Millisecond)
+
+	stats := testWriter.Stats()
+	assert.Equal(t, uint64(4), stats.LinesAccepted)
+	assert.Equal(t, uint64(1), stats.LinesRejected)
+	assert.Equal(t, uint64(1), stats.BatchesSent)
+	assert.Equal(t, uint64(1), stats.BatchesFailed)
+	assert.Equal(t, uint64(len("a v=1\na v=2\n")), stats.BytesSent)
+	assert.Equal(t, uint64(0), stats.Retries)
+	assert.Equal(t, uint64(2), stats.DroppedEntries)
+	assert.Equal(t, uint64(len("a v=3\n")), stats.BufferSize)
+	assert.Equal(t, uint64(0), stats.PendingBatches)
+	assert.Equal(t, 400, stats.LastError.StatusCode)
+	assert.Equal(t, uint64(2), stats.SendLatency.Count)
+}
@@ -0,0 +1,45 @@
+package writer
+
+import (
+	"context"
+	"net/http"
+)
+
+// SendInfo describes a write request when its span starts.
+type SendInfo struct {
+	Bucket  string
+	Size    uint64
+	Entries uint64
+	Attempt uint
+}
+
+// SendResult describes a write request when its span ends, Err is nil when
+// the batch was written.
+type SendResult struct {
+	StatusCode int
+	RequestID  string
+	Err        error
+}
+
+// Tracer starts a span for every write request. Inject adds the trace context
+// of ctx to the request headers.
+type Tracer interface {
+	Start(ctx context.Context, info SendInfo) (context.Context, Span)
+	Inject(ctx context.Context, header http.Header)
+}
+
+type Span interface {
+	End(result SendResult)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, info SendInfo) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(ctx context.Context, header http.Header) {}
+
+type noopSpan struct{}
+
+func (noopSpan) End(result SendResult) {}
@@ -0,0 +1,99 @@
+package writer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	info   SendInfo
+	result SendResult
+}
+
+type testTracer struct {
+	lock  sync.Mutex
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, info SendInfo) (context.Context, Span) {
+	span := &testSpan{info: info}
+
+	t.lock.Lock()
+	t.spans = append(t.spans, span)
+	t.lock.Unlock()
+
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (t *testTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		header.Set("X-Test-Attempt", strconv.FormatUint(uint64(span.info.Attempt), 10))
+	}
+}
+
+func (s *testSpan) End(result SendResult) {
+	s.result = result
+}
+
+func Test_Tracer(t *testing.T) {
+	attempts := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := r.Header.Get("X-Test-Attempt")
+		attempts <- attempt
+
+		w.Header().Set("X-Request-Id", "id"+attempt)
+		if attempt == "1" {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	tracer := &testTracer{}
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetBucket("bucket").
+		SetLogger(&mockLogger{}).
+		SetTracer(tracer).
+		SetSendInterval(time.Hour).
+		SetRetryInitialBackoff(time.Millisecond).
+		SetRetryJitter(0))
+
+	testWriter.WriteLine("a v=1")
+	assert.Nil(t, testWriter.Flush(context.Background()))
+	testWriter.Close()
+
+	assert.Equal(t, "1", <-attempts)
+	assert.Equal(t, "2", <-attempts)
+
+	assert.Len(t, tracer.spans, 2)
+	assert.Equal(t, SendInfo{Bucket: "bucket", Size: 6, Entries: 1, Attempt: 1}, tracer.spans[0].info)
+	assert.Equal(t, 503, tracer.spans[0].result.StatusCode)
+	assert.Equal(t, "id1", tracer.spans[0].result.RequestID)
+	assert.EqualError(t, tracer.spans[0].result.Err, "request_id: id1, status_code: 503, error: ")
+
+	assert.Equal(t, SendInfo{Bucket: "bucket", Size: 6, Entries: 1, Attempt: 2}, tracer.spans[1].info)
+	assert.Equal(t, SendResult{StatusCode: 204, RequestID: "id2"}, tracer.spans[1].result)
+}
+
+func Test_Tracer_Database(t *testing.T) {
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetLogger(&mockLogger{}).
+		SetAPIVersion(APIv1).
+		SetDatabase("db"))
+	defer testWriter.Close()
+
+	assert.Equal(t, "db", testWriter.(*writer).bucket)
+	assert.Equal(t, noopTracer{}, testWriter.(*writer).tracer)
+}
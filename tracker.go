@@ -0,0 +1,83 @@
+package writer
+
+import "sync"
+
+type tracker struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	seq     uint64
+	pending map[uint64]struct{}
+	// err is the error of the earliest failed batch since the last wait, the
+	// errors of later batches are not kept, so that a writer which is never
+	// flushed does not hold them.
+	err    error
+	errSeq uint64
+}
+
+func newTracker() *tracker {
+	t := &tracker{
+		pending: make(map[uint64]struct{}),
+	}
+
+	t.cond = sync.NewCond(&t.lock)
+
+	return t
+}
+
+func (t *tracker) add() uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.seq++
+	t.pending[t.seq] = struct{}{}
+
+	return t.seq
+}
+
+func (t *tracker) last() uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.seq
+}
+
+func (t *tracker) done(seq uint64, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.pending, seq)
+
+	if err != nil && (t.err == nil || seq < t.errSeq) {
+		t.err, t.errSeq = err, seq
+	}
+
+	t.cond.Broadcast()
+}
+
+func (t *tracker) wait(seq uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for t.waiting(seq) {
+		t.cond.Wait()
+	}
+
+	if t.err == nil || t.errSeq > seq {
+		return nil
+	}
+
+	err := t.err
+	t.err, t.errSeq = nil, 0
+
+	return err
+}
+
+func (t *tracker) waiting(seq uint64) bool {
+	for s := range t.pending {
+		if s <= seq {
+			return true
+		}
+	}
+
+	return false
+}
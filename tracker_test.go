@@ -0,0 +1,48 @@
+package writer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tracker(t *testing.T) {
+	testTracker := newTracker()
+	assert.Equal(t, uint64(0), testTracker.last())
+	assert.Nil(t, testTracker.wait(testTracker.last()))
+
+	seq1 := testTracker.add()
+	seq2 := testTracker.add()
+	seq3 := testTracker.add()
+	assert.Equal(t, seq3, testTracker.last())
+
+	result := make(chan error, 1)
+	go func() {
+		result <- testTracker.wait(seq2)
+	}()
+
+	testTracker.done(seq2, errors.New("test2"))
+
+	select {
+	case <-result:
+		t.Fatal("wait returned before all batches are done")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	testTracker.done(seq1, errors.New("test1"))
+	assert.EqualError(t, <-result, "test1")
+
+	testTracker.done(seq3, errors.New("test3"))
+	assert.EqualError(t, testTracker.wait(seq3), "test3")
+	assert.Nil(t, testTracker.wait(seq3))
+
+	for i := 0; i < 3; i++ {
+		testTracker.done(testTracker.add(), errors.New("test"))
+	}
+	assert.Equal(t, seq3+1, testTracker.errSeq)
+	assert.Nil(t, testTracker.wait(seq3))
+	assert.EqualError(t, testTracker.wait(testTracker.last()), "test")
+	assert.Nil(t, testTracker.err)
+}
@@ -1,31 +1,103 @@
 package writer
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/a-kataev/go-influxdb-writer/internal/batch"
 	"github.com/a-kataev/go-influxdb-writer/internal/client"
+	"github.com/a-kataev/go-influxdb-writer/internal/lineprotocol"
+	"github.com/a-kataev/go-influxdb-writer/internal/queue"
+	"github.com/a-kataev/go-influxdb-writer/internal/retry"
 )
 
 type Writer interface {
 	WriteLine(line string)
 	Write(b []byte)
+	WriteToBucket(bucket string, b []byte)
+	WriteContext(ctx context.Context, b []byte) error
+	TryWrite(b []byte) bool
+	WritePoint(p *Point)
+	WritePointToBucket(bucket string, p *Point)
+	Flush(ctx context.Context) error
+	Stats() Stats
+	Shutdown(ctx context.Context) (ShutdownResult, error)
 	Close()
 }
 
 type writerOptions struct {
-	SendInterval time.Duration
-	SendTimeout  time.Duration
+	SendInterval      time.Duration
+	SendTimeout       time.Duration
+	MaxInFlight       uint
+	Concurrency       uint
+	ValidateLines     bool
+	InputQueueSize    uint
+	OverflowPolicy    OverflowPolicy
+	SpillDir          string
+	SpillMaxSize      uint64
+	ReplicaMaxPending uint
+}
+
+type entry struct {
+	line   []byte
+	point  *Point
+	bucket string
+}
+
+type job struct {
+	batch batch.Batch
+	seq   uint64
+	route *route
 }
 
 type writer struct {
-	client       client.Client
-	batch        batch.Batch
-	write        chan []byte
-	sendInterval time.Duration
-	sendTimeout  time.Duration
-	logger       Logger
+	stats         stats
+	client        client.Client
+	batch         batch.Batch
+	batches       chan batch.Batch
+	pending       chan *job
+	tracker       *tracker
+	done          chan struct{}
+	write         chan entry
+	closing       chan struct{}
+	closeOnce     sync.Once
+	abort         chan struct{}
+	abortOnce     sync.Once
+	lock          sync.RWMutex
+	closed        bool
+	enqueuing     sync.WaitGroup
+	overflow      OverflowPolicy
+	spill         *spill
+	encoder       *pointEncoder
+	validate      bool
+	flush         chan chan error
+	sendInterval  time.Duration
+	sendTimeout   time.Duration
+	retry         *retry.Options
+	queue         queue.Queue
+	paused        pauser
+	errorHandler  func(*WriteError)
+	deadLetter    DeadLetter
+	logger        StructuredLogger
+	logLevel      Level
+	tracer        Tracer
+	bucket        string
+	router        Router
+	routes        map[string]*route
+	routesLock    sync.Mutex
+	clientOptions *client.Options
+	primary       *replica
+	replicas      []*replica
+	batchOptions  *batch.Options
 }
 
 func NewWriter(serverURL, authToken, bucket string) Writer {
@@ -37,82 +109,929 @@ func NewWriterWithOptions(options *Options) Writer {
 	if options == nil {
 		options = DefaultOptions()
 	}
+
+	concurrency := options.Writer.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	inFlight := options.Writer.MaxInFlight
+	if inFlight < concurrency {
+		inFlight = concurrency
+	}
+
+	tracer := options.Tracer
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+
+	clientOptions := *options.Client
+	clientOptions.InjectHeaders = tracer.Inject
+
+	if clientOptions.HTTPClient == nil {
+		clientOptions.HTTPClient = &http.Client{
+			Timeout: clientOptions.HTTPTimeout,
+		}
+	}
+
+	bucket := options.Client.Bucket
+	if options.Client.APIVersion == APIv1 {
+		bucket = options.Client.Database
+	}
+
 	w := &writer{
-		client:       client.New(options.Client),
-		batch:        batch.New(options.Batch),
-		write:        make(chan []byte),
-		sendInterval: options.Writer.SendInterval,
-		sendTimeout:  options.Writer.SendTimeout,
-		logger:       options.Logger,
+		client:        client.New(&clientOptions),
+		batch:         batch.New(options.Batch),
+		batches:       make(chan batch.Batch, inFlight+1),
+		pending:       make(chan *job, inFlight),
+		tracker:       newTracker(),
+		done:          make(chan struct{}),
+		write:         make(chan entry, options.Writer.InputQueueSize),
+		closing:       make(chan struct{}),
+		abort:         make(chan struct{}),
+		overflow:      options.Writer.OverflowPolicy,
+		encoder:       &pointEncoder{precision: parsePrecision(options.Client.Precision)},
+		validate:      options.Writer.ValidateLines,
+		flush:         make(chan chan error),
+		sendInterval:  options.Writer.SendInterval,
+		sendTimeout:   options.Writer.SendTimeout,
+		retry:         options.Retry,
+		errorHandler:  options.ErrorHandler,
+		deadLetter:    options.DeadLetter,
+		logger:        newStructuredLogger(options),
+		logLevel:      options.LogLevel,
+		tracer:        tracer,
+		bucket:        bucket,
+		router:        options.Router,
+		clientOptions: &clientOptions,
+		batchOptions:  options.Batch,
+	}
+
+	if len(options.Queue.Dir) > 0 {
+		q, err := queue.New(options.Queue)
+		if err != nil {
+			w.log(LevelError, "queue.new", Field{"error", err})
+			w.reportError(&WriteError{Err: err})
+		} else {
+			w.queue = q
+		}
+	}
+
+	for _, replica := range options.Replicas {
+		w.replicas = append(w.replicas, w.newReplica(replica, options))
+	}
+
+	if len(w.replicas) > 0 {
+		w.primary = w.newPrimary(options)
+	}
+
+	if w.overflow == OverflowSpill {
+		s, err := newSpill(options.Writer.SpillDir, options.Writer.SpillMaxSize)
+		if err != nil {
+			w.log(LevelError, "spill.new", Field{"error", err})
+			w.reportError(&WriteError{Err: err})
+
+			w.overflow = OverflowBlock
+		} else {
+			w.spill = s
+		}
+	}
+
+	for i := uint(0); i < inFlight; i++ {
+		w.batches <- batch.New(options.Batch)
 	}
 
 	go w.run()
+	go w.senders(concurrency)
 
 	return w
 }
 
 func (w *writer) run() {
-	w.logger.Infof("started")
+	w.log(LevelInfo, "started")
 
 	ticker := time.NewTicker(w.sendInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case b, ok := <-w.write:
-			if !ok {
-				return
+		case <-w.closing:
+			w.enqueuing.Wait()
+			w.drain()
+
+			// A failed attempt leaves the spilled lines in the directory for
+			// the next start.
+			for attempt := 0; attempt < spillCloseAttempts && w.spill != nil &&
+				w.spill.pending() && !w.aborted(); attempt++ {
+				w.unspill()
+			}
+
+			if w.spill != nil {
+				if w.spill.pending() {
+					w.log(LevelError, "spill: lines left", Field{"dir", w.spill.dir})
+				}
+
+				if err := w.spill.close(); err != nil {
+					w.log(LevelError, "spill.close", Field{"error", err})
+				}
 			}
 
-			if err := w.batch.Write(b); err == nil {
-				w.send()
+			if w.batch.Entries() > 0 {
+				w.pending <- &job{batch: w.batch, seq: w.tracker.add()}
+			}
 
-				if err := w.batch.Write(b); err != nil {
-					w.logger.Errorf("batch.write: %s", err)
+			for _, r := range w.routeList() {
+				if r.batch.Entries() > 0 {
+					w.pending <- &job{batch: r.batch, seq: w.tracker.add(), route: r}
 				}
+			}
+
+			close(w.pending)
+
+			return
+		case e := <-w.write:
+			handedOff := w.process(e)
+
+			if len(w.write) == 0 && w.unspill() {
+				handedOff = true
+			}
 
+			if handedOff {
 				ticker.Stop()
 				ticker = time.NewTicker(w.sendInterval)
-			} else if err != nil {
-				w.logger.Errorf("batch.write: %s", err)
 			}
+
+			w.buffer()
+		case result := <-w.flush:
+			w.drain()
+			w.unspill()
+			w.handOffAll()
+
+			go func(seq uint64) {
+				result <- w.tracker.wait(seq)
+			}(w.tracker.last())
+
+			ticker.Stop()
+			ticker = time.NewTicker(w.sendInterval)
 		case <-ticker.C:
-			w.send()
+			w.unspill()
+			w.handOffAll()
 		}
 	}
 }
 
-func (w *writer) send() {
-	ctx, cancel := context.WithTimeout(context.Background(), w.sendTimeout)
-	defer cancel()
+// process appends the entry to the batch, it reports whether the batch was
+// handed off to the senders.
+func (w *writer) process(e entry) bool {
+	r := w.routeOf(e)
 
-	defer w.batch.Reset()
+	if err := w.append(r, e); err == nil {
+		return false
+	}
 
-	reader := w.batch.Reader()
-	if reader.Size == 0 && reader.Entries == 0 {
+	w.handOff(r)
+
+	if err := w.append(r, e); err != nil {
+		w.writeFailed(e, err)
+	}
+
+	return true
+}
+
+// drain processes the entries which are already in the input queue.
+func (w *writer) drain() bool {
+	if len(w.write) == 0 {
+		return false
+	}
+
+	handedOff := false
+
+	// The drop-oldest policy may take entries from the queue meanwhile.
+drain:
+	for i := len(w.write); i > 0; i-- {
+		select {
+		case e := <-w.write:
+			if w.process(e) {
+				handedOff = true
+			}
+		default:
+			break drain
+		}
+	}
+
+	w.buffer()
+
+	return handedOff
+}
+
+// unspill processes the lines from the spill file.
+func (w *writer) unspill() bool {
+	if w.spill == nil || !w.spill.pending() {
+		return false
+	}
+
+	path, err := w.spill.take()
+	if err != nil {
+		w.log(LevelError, "spill.take", Field{"error", err})
+		w.reportError(&WriteError{Err: err})
+
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		w.log(LevelError, "spill.read", Field{"error", err})
+		w.reportError(&WriteError{Err: err})
+
+		return false
+	}
+	defer file.Close()
+
+	handedOff := false
+	bucket := ""
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+
+		if bytes.HasPrefix(line, bucketMarker) {
+			bucket, _ = unmarkBucket(line)
+		} else if len(line) > 0 && w.process(entry{line: line, bucket: bucket}) {
+			handedOff = true
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			w.log(LevelError, "spill.read", Field{"error", err})
+			w.reportError(&WriteError{Err: err})
+
+			return handedOff
+		}
+	}
+
+	if err := w.spill.release(); err != nil {
+		w.log(LevelError, "spill.remove", Field{"error", err})
+		w.reportError(&WriteError{Err: err})
+	}
+
+	w.buffer()
+
+	return handedOff
+}
+
+func (w *writer) handOff(r *route) {
+	b := w.batchOf(r)
+	if b.Entries() == 0 {
+		return
+	}
+
+	w.pending <- &job{batch: b, seq: w.tracker.add(), route: r}
+	w.setBatch(r, <-w.batches)
+
+	w.buffer()
+}
+
+func (w *writer) handOffAll() {
+	w.handOff(nil)
+
+	for _, r := range w.routeList() {
+		w.handOff(r)
+	}
+}
+
+func (w *writer) senders(concurrency uint) {
+	defer func() {
+		w.log(LevelInfo, "stopped")
+
+		close(w.done)
+	}()
+
+	servers := w.servers()
+	for _, rep := range servers {
+		go w.serve(rep, segmentsOf(rep.queue), concurrency)
+	}
+
+	wg := sync.WaitGroup{}
+
+	// The segments left by the previous run are listed before the senders
+	// put new ones, and are replayed next to the senders, so that the
+	// writer takes new batches right away.
+	if w.primary == nil {
+		segments := segmentsOf(w.queue)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			w.replay(segments)
+		}()
+	}
+
+	for i := uint(0); i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			w.sender()
+		}()
+	}
+
+	wg.Wait()
+
+	for _, rep := range servers {
+		close(rep.pending)
+		<-rep.done
+	}
+}
+
+// sender delivers the batches to the server, or with replicas, only hands
+// them to the servers.
+func (w *writer) sender() {
+	for j := range w.pending {
+		var err error
+
+		if w.primary != nil {
+			w.fanOut(j)
+		} else {
+			err = w.send(j.batch, j.route)
+		}
+
+		// Batches of routes are not taken back on close, so the pool may be
+		// full then.
+		select {
+		case w.batches <- j.batch:
+		default:
+		}
+
+		if w.primary == nil {
+			w.tracker.done(j.seq, err)
+		}
+	}
+}
+
+func (w *writer) append(r *route, e entry) error {
+	err := w.appendEntry(w.batchOf(r), e)
+	if err == nil {
+		atomic.AddUint64(&w.stats.linesAccepted, 1)
+	}
+
+	return err
+}
+
+func (w *writer) appendEntry(b batch.Batch, e entry) error {
+	if e.point == nil {
+		return b.Write(e.line)
+	}
+
+	w.encoder.point = e.point
+	defer func() {
+		w.encoder.point = nil
+	}()
+
+	return b.Append(w.encoder)
+}
+
+func (w *writer) writeFailed(e entry, err error) {
+	size := len(e.line)
+	if e.point != nil {
+		size = len(appendPoint(nil, e.point, w.encoder.precision))
+	}
+
+	atomic.AddUint64(&w.stats.linesRejected, 1)
+
+	w.log(LevelError, "batch.write", Field{"size", size}, Field{"error", err})
+	w.reportError(&WriteError{
+		Err:     err,
+		Size:    uint64(size),
+		Entries: 1,
+		Dropped: true,
+	})
+}
+
+func (w *writer) log(level Level, msg string, fields ...Field) {
+	if level < w.logLevel {
 		return
 	}
 
-	resp, err := w.client.Send(ctx, reader.Reader)
+	w.logger.Log(level, msg, fields...)
+}
+
+func (w *writer) reportError(err *WriteError) {
+	w.reportRouteError(nil, err)
+}
+
+// reportRouteError counts the error to the stats of the server of the route.
+func (w *writer) reportRouteError(r *route, err *WriteError) {
+	w.statsOf(r).error(err)
+
+	if w.errorHandler != nil {
+		w.errorHandler(err)
+	}
+}
+
+// statsOf returns the stats of the server of the route, the primary server
+// counts to the stats of the writer.
+func (w *writer) statsOf(r *route) *stats {
+	if r != nil && r.replica != nil {
+		return &r.replica.stats
+	}
+
+	return &w.stats
+}
+
+func (w *writer) replay(ids []string) {
+	w.replaySegments(w.queue, ids, w.route)
+}
+
+func segmentsOf(q queue.Queue) []string {
+	if q == nil {
+		return nil
+	}
+
+	return q.Segments()
+}
+
+// replaySegments delivers the segments and returns the ones which failed
+// temporarily and are kept in the queue.
+func (w *writer) replaySegments(q queue.Queue, ids []string, routeOf func(bucket string) *route) []string {
+	var failed []string
+
+	for _, id := range ids {
+		data, err := q.Read(id)
+		if err != nil {
+			w.log(LevelError, "queue.read", Field{"segment", id}, Field{"error", err})
+			w.reportError(&WriteError{Err: err})
+			continue
+		}
+
+		bucket, data := unmarkBucket(data)
+		r := routeOf(bucket)
+
+		w.log(LevelInfo, "replay segment", r.fields(Field{"segment", id})...)
+
+		if err := w.deliver(r, data, uint64(bytes.Count(data, []byte{'\n'})), true); err == nil || !err.temporary {
+			w.remove(q, id)
+		} else {
+			failed = append(failed, id)
+		}
+	}
+
+	return failed
+}
+
+func (w *writer) send(b batch.Batch, r *route) error {
+	defer b.Reset()
+
+	data, entries, err := w.read(b)
 	if err != nil {
-		w.logger.Errorf("client.send: %s", err)
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	bucket := ""
+	if r != nil {
+		bucket = r.bucket
+	}
+
+	if _, writeErr := w.deliverQueued(w.queue, bucket, r, data, entries); writeErr != nil {
+		return writeErr
+	}
+
+	return nil
+}
+
+// read returns the data of the batch, the batch is dropped when it can't be
+// read.
+func (w *writer) read(b batch.Batch) ([]byte, uint64, *WriteError) {
+	reader := b.Reader()
+	if reader.Size == 0 && reader.Entries == 0 {
+		return nil, 0, nil
+	}
+
+	data, err := ioutil.ReadAll(reader.Reader)
+	if err != nil {
+		atomic.AddUint64(&w.stats.batchesFailed, 1)
+
+		w.log(LevelError, "batch.read",
+			Field{"size", reader.Size}, Field{"entries", reader.Entries}, Field{"error", err})
+		writeErr := &WriteError{
+			Err:     err,
+			Size:    reader.Size,
+			Entries: reader.Entries,
+			Dropped: true,
+		}
+		w.reportError(writeErr)
+
+		return nil, 0, writeErr
+	}
+
+	return data, reader.Entries, nil
+}
+
+// deliverQueued keeps the data in the durable queue, if it is set, until the
+// data is delivered or dropped. It returns the segment kept in the queue after
+// a temporary failure.
+func (w *writer) deliverQueued(q queue.Queue, bucket string, r *route, data []byte, entries uint64) (string, *WriteError) {
+	id := ""
+
+	if q != nil {
+		segment := data
+		if len(bucket) > 0 {
+			segment = markBucket(bucket, data)
+		}
+
+		var err error
+		if id, err = q.Put(segment); err != nil {
+			w.log(LevelError, "queue.put", r.fields(Field{"error", err})...)
+			w.reportRouteError(r, &WriteError{
+				Err:     err,
+				Size:    uint64(len(data)),
+				Entries: entries,
+			})
+		}
+	}
+
+	writeErr := w.deliver(r, data, entries, len(id) > 0)
+
+	if len(id) > 0 && (writeErr == nil || !writeErr.temporary) {
+		w.remove(q, id)
+
+		return "", writeErr
+	}
+
+	return id, writeErr
+}
+
+func (w *writer) remove(q queue.Queue, id string) {
+	if err := q.Remove(id); err != nil {
+		w.log(LevelError, "queue.remove", Field{"segment", id}, Field{"error", err})
+		w.reportError(&WriteError{Err: err})
+	}
+}
+
+func (w *writer) deliver(r *route, data []byte, entries uint64, persisted bool) *WriteError {
+	backoff := retry.New(w.retry)
+	stats := w.statsOf(r)
+
+	// The pause asked by the server counts against the retry budget too.
+	var deadline time.Time
+	if w.retry.MaxElapsedTime > 0 {
+		deadline = time.Now().Add(w.retry.MaxElapsedTime)
+	}
+
+	var rejectErr *WriteError
+
+	for attempt := uint(1); ; attempt++ {
+		w.pause(r, deadline)
+
+		err := w.sendBatch(r, data, entries, attempt)
+		if err == nil {
+			stats.sent(len(data), entries)
+
+			// The rejected lines are reported to the error handler, the batch
+			// itself is delivered.
+			return nil
+		}
+
+		if err.temporary && !w.aborted() {
+			if delay, ok := backoff.Next(); ok {
+				err.Retry = true
+				w.reportRouteError(r, err)
+
+				w.log(LevelWarn, "send batch: retry", r.fields(Field{"delay", delay})...)
+				w.sleep(delay)
+
+				continue
+			}
+		}
+
+		if rejectErr == nil && len(err.lineErrors) > 0 {
+			remainder, rejected := salvage(data, err.lineErrors)
+			err.Rejected = rejected
+
+			if len(rejected) > 0 && len(remainder) > 0 {
+				rejectErr = &WriteError{
+					Err:         err.Err,
+					Size:        uint64(len(data) - len(remainder)),
+					Entries:     uint64(len(rejected)),
+					StatusCode:  err.StatusCode,
+					RequestID:   err.RequestID,
+					ServerError: err.ServerError,
+					Response:    err.Response,
+					Bucket:      err.Bucket,
+					ServerURL:   err.ServerURL,
+					Rejected:    rejected,
+					Dropped:     true,
+				}
+				atomic.AddUint64(&stats.linesRejected, uint64(len(rejected)))
+
+				w.reportRouteError(r, rejectErr)
+				w.bury(joinLines(rejected), rejectErr)
+
+				data, entries = remainder, entries-uint64(len(rejected))
+
+				w.log(LevelWarn, "send batch: rejected", r.fields(
+					Field{"request_id", err.RequestID}, Field{"status_code", err.StatusCode},
+					Field{"rejected", len(rejected)}, Field{"entries", entries})...)
+
+				// The server has stored the other lines of a partial write,
+				// sending them again would duplicate them.
+				if err.partial {
+					stats.sent(len(data), entries)
+
+					return nil
+				}
+
+				continue
+			}
+		}
+
+		atomic.AddUint64(&stats.batchesFailed, 1)
+
+		fields := r.fields(
+			Field{"request_id", err.RequestID}, Field{"status_code", err.StatusCode},
+			Field{"size", len(data)}, Field{"entries", entries})
+
+		// A batch in the durable queue is kept there for a later attempt.
+		if err.temporary && persisted {
+			w.reportRouteError(r, err)
+			w.log(LevelError, "send batch: kept", fields...)
+
+			return err
+		}
+
+		err.Dropped = true
+		w.reportRouteError(r, err)
+
+		w.log(LevelError, "send batch: dropped", fields...)
+
+		w.bury(data, err)
+
+		return err
+	}
+}
+
+func (w *writer) bury(data []byte, err *WriteError) {
+	if w.deadLetter == nil {
 		return
 	}
 
+	if putErr := w.deadLetter.Put(data, err); putErr != nil {
+		w.log(LevelError, "dead_letter.put",
+			Field{"size", len(data)}, Field{"error", putErr})
+	}
+}
+
+func joinLines(rejected []RejectedLine) []byte {
+	data := make([]byte, 0)
+
+	for _, line := range rejected {
+		data = append(data, line.Line...)
+		data = append(data, '\n')
+	}
+
+	return data
+}
+
+func salvage(data []byte, lineErrors []client.LineError) ([]byte, []RejectedLine) {
+	numbers := make(map[int]string)
+	texts := make(map[string]string)
+
+	for _, lineErr := range lineErrors {
+		if lineErr.Line > 0 {
+			numbers[lineErr.Line] = lineErr.Reason
+		} else {
+			texts[lineErr.Text] = lineErr.Reason
+		}
+	}
+
+	remainder := make([]byte, 0, len(data))
+	rejected := make([]RejectedLine, 0, len(lineErrors))
+
+	for number := 1; len(data) > 0; number++ {
+		line := data
+		data = nil
+
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, data = line[:i], line[i+1:]
+		}
+
+		reason, ok := numbers[number]
+		if !ok {
+			reason, ok = texts[string(line)]
+		}
+
+		if ok {
+			rejected = append(rejected, RejectedLine{
+				Line:   string(line),
+				Reason: reason,
+			})
+			continue
+		}
+
+		remainder = append(remainder, line...)
+		remainder = append(remainder, '\n')
+	}
+
+	return remainder, rejected
+}
+
+func (w *writer) sendBatch(r *route, data []byte, entries uint64, attempt uint) (writeErr *WriteError) {
+	c, bucket := w.target(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.sendTimeout)
+	defer cancel()
+
+	go func(abort, done <-chan struct{}) {
+		select {
+		case <-abort:
+			cancel()
+		case <-done:
+		}
+	}(w.abort, ctx.Done())
+
+	ctx, span := w.startSpan(ctx, SendInfo{
+		Bucket:  bucket,
+		Size:    uint64(len(data)),
+		Entries: entries,
+		Attempt: attempt,
+	})
+
+	result := SendResult{}
+	defer func() {
+		if writeErr != nil {
+			if r != nil {
+				writeErr.Bucket = r.bucket
+			}
+
+			if r != nil && r.replica != nil {
+				writeErr.ServerURL = r.replica.url
+			}
+
+			result.Err = writeErr
+		}
+
+		span.End(result)
+	}()
+
+	started := time.Now()
+
+	resp, err := c.Send(ctx, bytes.NewReader(data))
+
+	w.statsOf(r).observe(time.Since(started))
+
+	if err != nil {
+		w.log(LevelWarn, "client.send", r.fields(
+			Field{"size", len(data)}, Field{"entries", entries}, Field{"error", err})...)
+		return &WriteError{
+			Err:       err,
+			Size:      uint64(len(data)),
+			Entries:   entries,
+			temporary: true,
+		}
+	}
+
+	result.StatusCode = resp.StatusCode
+	result.RequestID = resp.RequestID
+
 	if resp.StatusCode == 204 {
-		w.logger.Infof("send batch: size: %d, entries: %d",
-			reader.Size, reader.Entries)
-		return
+		w.log(LevelDebug, "send batch", r.fields(
+			Field{"request_id", resp.RequestID}, Field{"status_code", resp.StatusCode},
+			Field{"size", len(data)}, Field{"entries", entries})...)
+		return nil
+	}
+
+	if resp.RetryAfter > 0 {
+		delay := resp.RetryAfter
+		if w.retry.MaxBackoff > 0 && delay > w.retry.MaxBackoff {
+			delay = w.retry.MaxBackoff
+		}
+
+		w.pauserOf(r).set(delay)
+	}
+
+	fields := []Field{
+		{"request_id", resp.RequestID},
+		{"status_code", resp.StatusCode},
+		{"size", len(data)},
+		{"entries", entries},
 	}
 
 	if len(resp.ResponseError) > 0 {
-		w.logger.Errorf("client.send: request_id: %s, status_code: %d, error: '%s'",
-			resp.RequestID, resp.StatusCode, resp.ResponseError)
+		fields = append(fields, Field{"error", resp.ResponseError})
+	} else {
+		fields = append(fields, Field{"response", resp.Response})
+	}
+
+	level := LevelError
+	if retryable(resp.StatusCode) {
+		level = LevelWarn
+	}
+
+	w.log(level, "client.send", r.fields(fields...)...)
+
+	return &WriteError{
+		Err:         newResponseError(resp.ResponseError, resp.Response),
+		Size:        uint64(len(data)),
+		Entries:     entries,
+		StatusCode:  resp.StatusCode,
+		RequestID:   resp.RequestID,
+		ServerError: resp.ResponseError,
+		Response:    resp.Response,
+		temporary:   retryable(resp.StatusCode),
+		partial:     resp.Partial,
+		lineErrors:  resp.LineErrors,
+	}
+}
+
+func (w *writer) startSpan(ctx context.Context, info SendInfo) (context.Context, Span) {
+	if w.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	return w.tracer.Start(ctx, info)
+}
+
+// pauser keeps the time until which a server asked to wait with Retry-After.
+type pauser struct {
+	lock  sync.Mutex
+	until time.Time
+}
+
+func (p *pauser) set(delay time.Duration) {
+	p.lock.Lock()
+	p.until = time.Now().Add(delay)
+	p.lock.Unlock()
+}
+
+func (p *pauser) delay() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return time.Until(p.until)
+}
+
+func (w *writer) pauserOf(r *route) *pauser {
+	if r != nil && r.replica != nil {
+		return &r.replica.paused
+	}
+
+	return &w.paused
+}
+
+// pause waits until the server accepts writes again, but not past the
+// deadline of the retry budget, when it is set.
+func (w *writer) pause(r *route, deadline time.Time) {
+	delay := w.pauserOf(r).delay()
+	if !deadline.IsZero() {
+		if remaining := time.Until(deadline); delay > remaining {
+			delay = remaining
+		}
+	}
+
+	if delay <= 0 {
 		return
 	}
 
-	w.logger.Errorf("client.send: request_id: %s, status_code: %d, response: '%s'",
-		resp.RequestID, resp.StatusCode, resp.Response)
+	w.log(LevelWarn, "send batch: paused", r.fields(Field{"delay", delay.Round(time.Millisecond)})...)
+	w.sleep(delay)
+}
+
+// sleep waits for the delay or until the writer is aborted.
+func (w *writer) sleep(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-w.abort:
+	}
+}
+
+func (w *writer) aborted() bool {
+	select {
+	case <-w.abort:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == 429 || statusCode >= 500
 }
 
 func (w *writer) WriteLine(line string) {
@@ -120,13 +1039,302 @@ func (w *writer) WriteLine(line string) {
 }
 
 func (w *writer) Write(b []byte) {
-	w.write <- b
+	if err := w.WriteContext(context.Background(), b); errors.Is(err, ErrClosed) {
+		w.writeClosed(uint64(len(b)))
+	}
 }
 
-func (w *writer) Close() {
-	close(w.write)
+func (w *writer) WriteToBucket(bucket string, b []byte) {
+	if err := w.validateLine(b); err != nil {
+		return
+	}
+
+	if err := w.enqueue(context.Background(), entry{line: b, bucket: bucket}, true); errors.Is(err, ErrClosed) {
+		w.writeClosed(uint64(len(b)))
+	}
+}
+
+func (w *writer) WriteContext(ctx context.Context, b []byte) error {
+	if err := w.validateLine(b); err != nil {
+		return err
+	}
+
+	return w.enqueue(ctx, entry{line: b}, true)
+}
+
+func (w *writer) TryWrite(b []byte) bool {
+	if err := w.validateLine(b); err != nil {
+		return false
+	}
+
+	return w.enqueue(context.Background(), entry{line: b}, false) == nil
+}
+
+// enqueue puts the entry into the input queue, when the queue is full the
+// overflow policy decides what happens. The read lock is only held to check
+// closed and to count the call in enqueuing, which Close waits for before it
+// drains the queue. The entries dropped by the overflow policy are reported
+// afterwards, so that the error handler may call Close.
+func (w *writer) enqueue(ctx context.Context, e entry, wait bool) error {
+	w.lock.RLock()
+	if w.closed {
+		w.lock.RUnlock()
+
+		return ErrClosed
+	}
+	w.enqueuing.Add(1)
+	w.lock.RUnlock()
+
+	dropped, err := w.put(ctx, e, wait)
+	w.enqueuing.Done()
+
+	for _, e := range dropped {
+		w.overflowed(e)
+	}
+
+	return err
+}
+
+// put puts the entry into the input queue and returns the entries dropped by
+// the overflow policy.
+func (w *writer) put(ctx context.Context, e entry, wait bool) ([]entry, error) {
+	select {
+	case w.write <- e:
+		return nil, nil
+	default:
+	}
+
+	switch w.overflow {
+	case OverflowDropNewest:
+		return []entry{e}, ErrOverflow
+	case OverflowDropOldest:
+		if cap(w.write) == 0 {
+			return []entry{e}, ErrOverflow
+		}
+
+		var dropped []entry
+
+		for {
+			select {
+			case w.write <- e:
+				return dropped, nil
+			default:
+			}
+
+			select {
+			case old := <-w.write:
+				dropped = append(dropped, old)
+			default:
+			}
+		}
+	case OverflowSpill:
+		line := e.line
+		if e.point != nil {
+			line = appendPoint(nil, e.point, w.encoder.precision)
+		}
+
+		if err := w.spill.put(e.bucket, line); err != nil {
+			w.log(LevelError, "spill.put", Field{"size", len(line)}, Field{"error", err})
+
+			return []entry{e}, ErrOverflow
+		}
+
+		atomic.AddUint64(&w.stats.linesSpilled, 1)
+
+		return nil, nil
+	}
+
+	if !wait {
+		return nil, ErrOverflow
+	}
+
+	select {
+	case w.write <- e:
+		return nil, nil
+	case <-w.closing:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// overflowed reports the entry dropped by the overflow policy. It is not
+// logged, so that a full queue does not flood the log.
+func (w *writer) overflowed(e entry) {
+	atomic.AddUint64(&w.stats.linesOverflowed, 1)
 
-	w.send()
+	w.reportError(&WriteError{
+		Err:     ErrOverflow,
+		Size:    uint64(len(e.line)),
+		Entries: 1,
+		Bucket:  e.bucket,
+		Dropped: true,
+	})
+}
+
+func (w *writer) validateLine(b []byte) error {
+	if !w.validate {
+		return nil
+	}
+
+	err := lineprotocol.Validate(b)
+	if err != nil {
+		atomic.AddUint64(&w.stats.linesRejected, 1)
+
+		w.log(LevelError, "write line", Field{"size", len(b)}, Field{"error", err})
+		w.reportError(&WriteError{
+			Err:     err,
+			Size:    uint64(len(b)),
+			Entries: 1,
+			Dropped: true,
+		})
+	}
+
+	return err
+}
+
+func (w *writer) writeClosed(size uint64) {
+	w.log(LevelError, "write", Field{"size", size}, Field{"error", ErrClosed})
+	w.reportError(&WriteError{
+		Err:     ErrClosed,
+		Size:    size,
+		Entries: 1,
+		Dropped: true,
+	})
+}
+
+func (w *writer) WritePoint(p *Point) {
+	w.WritePointToBucket("", p)
+}
+
+func (w *writer) WritePointToBucket(bucket string, p *Point) {
+	if err := p.validate(); err != nil {
+		atomic.AddUint64(&w.stats.linesRejected, 1)
+
+		w.log(LevelError, "write point", Field{"error", err})
+		w.reportError(&WriteError{
+			Err:     err,
+			Entries: 1,
+			Dropped: true,
+		})
+		return
+	}
+
+	if err := w.enqueue(context.Background(), entry{point: p, bucket: bucket}, true); errors.Is(err, ErrClosed) {
+		w.writeClosed(0)
+	}
+}
+
+func (w *writer) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+
+	select {
+	case w.flush <- result:
+	case <-w.closing:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *writer) Stats() Stats {
+	stats := w.stats.snapshot()
+	stats.PendingBatches = uint64(len(w.pending))
+	stats.InputQueueLength = uint64(len(w.write))
 
-	w.logger.Infof("stopped")
+	if w.primary != nil {
+		stats.PendingBatches += uint64(len(w.primary.pending))
+	}
+
+	for _, rep := range w.replicas {
+		replica := rep.stats.snapshot()
+
+		stats.Replicas = append(stats.Replicas, ReplicaStats{
+			ServerURL:      rep.url,
+			BatchesSent:    replica.BatchesSent,
+			BatchesFailed:  replica.BatchesFailed,
+			BytesSent:      replica.BytesSent,
+			EntriesSent:    replica.EntriesSent,
+			LinesRejected:  replica.LinesRejected,
+			Retries:        replica.Retries,
+			DroppedEntries: replica.DroppedEntries,
+			PendingBatches: uint64(len(rep.pending)),
+			LastError:      replica.LastError,
+			LastErrorTime:  replica.LastErrorTime,
+		})
+	}
+
+	return stats
+}
+
+// Shutdown stops accepting writes, sends the queued, spilled and buffered
+// entries and waits until every batch is delivered or dropped. When the
+// context is done first, requests and retries in progress are aborted and the
+// remaining batches are dropped, to the dead letter if it is set. The result
+// is returned on success too, the error is a *ShutdownError when entries were
+// lost by any server or the context was done.
+func (w *writer) Shutdown(ctx context.Context) (ShutdownResult, error) {
+	stopped := make(chan struct{})
+
+	go func() {
+		w.closeOnce.Do(func() {
+			w.lock.Lock()
+			w.closed = true
+			close(w.closing)
+			w.lock.Unlock()
+		})
+
+		<-w.done
+
+		close(stopped)
+	}()
+
+	var err error
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+
+		w.abortOnce.Do(func() {
+			close(w.abort)
+		})
+
+		<-stopped
+	}
+
+	stats := w.Stats()
+	result := ShutdownResult{
+		Delivered: stats.EntriesSent,
+		Lost:      stats.DroppedEntries,
+	}
+
+	lost := result.Lost
+
+	for _, replica := range stats.Replicas {
+		result.Replicas = append(result.Replicas, ReplicaResult{
+			ServerURL: replica.ServerURL,
+			Delivered: replica.EntriesSent,
+			Lost:      replica.DroppedEntries,
+		})
+
+		lost += replica.DroppedEntries
+	}
+
+	if err == nil && lost == 0 {
+		return result, nil
+	}
+
+	return result, &ShutdownError{Err: err, ShutdownResult: result}
+}
+
+func (w *writer) Close() {
+	_, _ = w.Shutdown(context.Background())
 }
@@ -1,7 +1,16 @@
 package writer
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,6 +18,8 @@ import (
 	mocksBatch "github.com/a-kataev/go-influxdb-writer/internal/batch/mocks"
 	"github.com/a-kataev/go-influxdb-writer/internal/client"
 	mocksClient "github.com/a-kataev/go-influxdb-writer/internal/client/mocks"
+	"github.com/a-kataev/go-influxdb-writer/internal/queue"
+	"github.com/a-kataev/go-influxdb-writer/internal/retry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -27,15 +38,46 @@ func Test_New_Close(t *testing.T) {
 	defaultOptions := DefaultOptions()
 	options := defaultOptions.
 		SetLogger(logger).
+		SetLogLevel(defaultOptions.LogLevel).
+		SetTracer(defaultOptions.Tracer).
 		SetSendInterval(defaultOptions.Writer.SendInterval).
 		SetSendTimeout(defaultOptions.Writer.SendTimeout).
+		SetMaxInFlight(defaultOptions.Writer.MaxInFlight).
+		SetConcurrency(defaultOptions.Writer.Concurrency).
+		SetValidateLines(defaultOptions.Writer.ValidateLines).
+		SetInputQueueSize(defaultOptions.Writer.InputQueueSize).
+		SetOverflowPolicy(defaultOptions.Writer.OverflowPolicy).
+		SetSpillDir(defaultOptions.Writer.SpillDir).
+		SetSpillMaxSize(defaultOptions.Writer.SpillMaxSize).
+		SetReplicaMaxPending(defaultOptions.Writer.ReplicaMaxPending).
 		SetServerURL(defaultOptions.Client.ServerURL).
 		SetAuthToken(defaultOptions.Client.AuthToken).
+		SetOrg(defaultOptions.Client.Org).
+		SetOrgID(defaultOptions.Client.OrgID).
 		SetBucket(defaultOptions.Client.Bucket).
+		SetAPIVersion(defaultOptions.Client.APIVersion).
+		SetDatabase(defaultOptions.Client.Database).
+		SetRetentionPolicy(defaultOptions.Client.RetentionPolicy).
+		SetConsistency(defaultOptions.Client.Consistency).
+		SetUsername(defaultOptions.Client.Username).
+		SetPassword(defaultOptions.Client.Password).
+		SetBasicAuth(defaultOptions.Client.BasicAuth).
 		SetPrecision(defaultOptions.Client.Precision).
 		SetHTTPTimeout(defaultOptions.Client.HTTPTimeout).
+		SetGzip(defaultOptions.Client.Gzip).
+		SetGzipLevel(defaultOptions.Client.GzipLevel).
+		SetCompressedBatchSize(defaultOptions.Batch.CompressedSize).
 		SetBatchSize(defaultOptions.Batch.BufferSize).
-		SetEntriesLimit(defaultOptions.Batch.EntriesLimit)
+		SetEntriesLimit(defaultOptions.Batch.EntriesLimit).
+		SetRetryMaxAttempts(defaultOptions.Retry.MaxAttempts).
+		SetRetryInitialBackoff(defaultOptions.Retry.InitialBackoff).
+		SetRetryMaxBackoff(defaultOptions.Retry.MaxBackoff).
+		SetRetryJitter(defaultOptions.Retry.Jitter).
+		SetRetryMaxElapsedTime(defaultOptions.Retry.MaxElapsedTime)
+	assert.Equal(t, ErrOrgRequired, options.Validate())
+	assert.Nil(t, options.SetOrg("test").Validate())
+	assert.Equal(t, ErrSpillDirRequired, DefaultOptions().SetOrg("test").SetOverflowPolicy(OverflowSpill).Validate())
+	assert.Equal(t, ErrReplicaURLRequired, DefaultOptions().SetOrg("test").AddReplica(Replica{Bucket: "test"}).Validate())
 	testWriter3 := NewWriterWithOptions(options)
 	time.Sleep(10 * time.Millisecond)
 	testWriter3.Close()
@@ -48,44 +90,49 @@ func Test_New_Close(t *testing.T) {
 func Test_run(t *testing.T) {
 	tables := []struct {
 		batch  func() batch.Batch
+		next   func() batch.Batch
 		logger []string
+		jobs   int
 	}{
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Write", mock.Anything).Return(nil)
-				testBatch.On("Reader").Return(&batch.BatchReader{})
-				testBatch.On("Reset").Return()
+				testBatch.On("Entries").Return(uint64(1))
+				testBatch.On("Size").Return(uint64(5))
 				return testBatch
 			},
 			logger: []string{},
+			jobs:   1,
 		},
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Write", mock.Anything).Return(errors.New("test"))
-				testBatch.On("Reader").Return(&batch.BatchReader{})
-				testBatch.On("Reset").Return()
+				testBatch.On("Entries").Return(uint64(0))
+				testBatch.On("Size").Return(uint64(0))
 				return testBatch
 			},
-			logger: []string{"batch.write: test"},
+			logger: []string{"batch.write: size: 4, error: test"},
+			jobs:   0,
 		},
 		{
 			batch: func() batch.Batch {
-				count := 0
 				testBatch := &mocksBatch.Batch{}
-				testBatch.On("Write", mock.Anything).Return(func(_ []byte) error {
-					if count > 0 {
-						return errors.New("test")
-					}
-					count++
-					return nil
-				})
-				testBatch.On("Reader").Return(&batch.BatchReader{})
-				testBatch.On("Reset").Return()
+				testBatch.On("Write", mock.Anything).Return(batch.ErrLimitExceeded)
+				testBatch.On("Entries").Return(uint64(1))
+				testBatch.On("Size").Return(uint64(5))
+				return testBatch
+			},
+			next: func() batch.Batch {
+				testBatch := &mocksBatch.Batch{}
+				testBatch.On("Write", mock.Anything).Return(nil)
+				testBatch.On("Entries").Return(uint64(1))
+				testBatch.On("Size").Return(uint64(5))
 				return testBatch
 			},
-			logger: []string{"batch.write: test"},
+			logger: []string{},
+			jobs:   2,
 		},
 	}
 
@@ -96,28 +143,79 @@ func Test_run(t *testing.T) {
 
 		testWriter := &writer{
 			batch:        table.batch(),
-			write:        make(chan []byte, 1),
+			batches:      make(chan batch.Batch, 1),
+			pending:      make(chan *job, 2),
+			tracker:      newTracker(),
+			write:        make(chan entry),
+			closing:      make(chan struct{}),
 			logger:       logger,
-			sendInterval: 1 * time.Millisecond,
+			sendInterval: time.Hour,
+		}
+
+		if table.next != nil {
+			testWriter.batches <- table.next()
 		}
 
 		go func() {
-			testWriter.write <- []byte("test")
-			time.Sleep(10 * time.Millisecond)
-			close(testWriter.write)
+			testWriter.write <- entry{line: []byte("test")}
+			close(testWriter.closing)
 		}()
 		testWriter.run()
 
+		jobs := 0
+		for range testWriter.pending {
+			jobs++
+		}
+
 		assert.Equalf(t, table.logger, logger.ErrorLines, "%d", tt)
+		assert.Equalf(t, table.jobs, jobs, "%d", tt)
 	}
 }
 
+func Test_sender(t *testing.T) {
+	testBatch := &mocksBatch.Batch{}
+	testBatch.On("Reader").Return(&batch.BatchReader{
+		Reader:  strings.NewReader("1"),
+		Entries: 1,
+		Size:    1,
+	})
+	testBatch.On("Reset").Return()
+
+	testClient := &mocksClient.Client{}
+	testClient.On("Send", mock.Anything, mock.Anything).Return(&client.ClientResponse{
+		StatusCode:    400,
+		ResponseError: "test",
+	}, nil)
+
+	testWriter := &writer{
+		client:  testClient,
+		batches: make(chan batch.Batch, 1),
+		pending: make(chan *job, 1),
+		tracker: newTracker(),
+		done:    make(chan struct{}),
+		retry:   &retry.Options{},
+		logger:  &mockLogger{},
+	}
+
+	seq := testWriter.tracker.add()
+	testWriter.pending <- &job{batch: testBatch, seq: seq}
+	close(testWriter.pending)
+
+	testWriter.senders(2)
+
+	assert.EqualError(t, testWriter.tracker.wait(seq), "request_id: , status_code: 400, error: test")
+	assert.Equal(t, testBatch, <-testWriter.batches)
+	testBatch.AssertNumberOfCalls(t, "Reset", 1)
+
+	_, ok := <-testWriter.done
+	assert.False(t, ok)
+}
+
 func Test_send(t *testing.T) {
 	tables := []struct {
-		batch       func() batch.Batch
-		client      func() client.Client
-		loggerInfo  []string
-		loggerError []string
+		batch  func() batch.Batch
+		client func() client.Client
+		logger []string
 	}{
 		{
 			batch: func() batch.Batch {
@@ -130,13 +228,13 @@ func Test_send(t *testing.T) {
 				testClient := &mocksClient.Client{}
 				return testClient
 			},
-			loggerInfo:  []string{},
-			loggerError: []string{},
+			logger: nil,
 		},
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Reader").Return(&batch.BatchReader{
+					Reader:  strings.NewReader("1"),
 					Entries: 1,
 					Size:    1,
 				})
@@ -148,13 +246,16 @@ func Test_send(t *testing.T) {
 				testClient.On("Send", mock.Anything, mock.Anything).Return(nil, errors.New("test"))
 				return testClient
 			},
-			loggerInfo:  []string{},
-			loggerError: []string{"client.send: test"},
+			logger: []string{
+				"WARN client.send: size: 1, entries: 1, error: test",
+				"ERROR send batch: dropped: request_id: , status_code: 0, size: 1, entries: 1",
+			},
 		},
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Reader").Return(&batch.BatchReader{
+					Reader:  strings.NewReader("1"),
 					Entries: 1,
 					Size:    1,
 				})
@@ -168,13 +269,15 @@ func Test_send(t *testing.T) {
 				}, nil)
 				return testClient
 			},
-			loggerInfo:  []string{"send batch: size: 1, entries: 1"},
-			loggerError: []string{},
+			logger: []string{
+				"DEBUG send batch: request_id: , status_code: 204, size: 1, entries: 1",
+			},
 		},
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Reader").Return(&batch.BatchReader{
+					Reader:  strings.NewReader("1"),
 					Entries: 1,
 					Size:    1,
 				})
@@ -189,13 +292,16 @@ func Test_send(t *testing.T) {
 				}, nil)
 				return testClient
 			},
-			loggerInfo:  []string{},
-			loggerError: []string{"client.send: request_id: , status_code: 500, error: 'test'"},
+			logger: []string{
+				"WARN client.send: request_id: , status_code: 500, size: 1, entries: 1, error: test",
+				"ERROR send batch: dropped: request_id: , status_code: 500, size: 1, entries: 1",
+			},
 		},
 		{
 			batch: func() batch.Batch {
 				testBatch := &mocksBatch.Batch{}
 				testBatch.On("Reader").Return(&batch.BatchReader{
+					Reader:  strings.NewReader("1"),
 					Entries: 1,
 					Size:    1,
 				})
@@ -210,32 +316,31 @@ func Test_send(t *testing.T) {
 				}, nil)
 				return testClient
 			},
-			loggerInfo:  []string{},
-			loggerError: []string{"client.send: request_id: , status_code: 500, response: 'test'"},
+			logger: []string{
+				"WARN client.send: request_id: , status_code: 500, size: 1, entries: 1, response: test",
+				"ERROR send batch: dropped: request_id: , status_code: 500, size: 1, entries: 1",
+			},
 		},
 	}
 
 	for tt, table := range tables {
-		logger := &mockLogger{
-			InfoLines:  make([]string, 0),
-			ErrorLines: make([]string, 0),
-		}
+		logger := &mockLogger{}
 
 		testWriter := &writer{
 			batch:  table.batch(),
 			client: table.client(),
+			retry:  &retry.Options{},
 			logger: logger,
 		}
 
-		testWriter.send()
-		assert.Equalf(t, table.loggerInfo, logger.InfoLines, "%d", tt)
-		assert.Equalf(t, table.loggerError, logger.ErrorLines, "%d", tt)
+		testWriter.send(testWriter.batch, nil)
+		assert.Equalf(t, table.logger, logger.Lines, "%d", tt)
 	}
 }
 
 func Test_Write(t *testing.T) {
 	testClient := &writer{
-		write: make(chan []byte, 3),
+		write: make(chan entry, 3),
 	}
 	defer close(testClient.write)
 
@@ -249,6 +354,1011 @@ func Test_Write(t *testing.T) {
 
 	for i := 0; i < len(buffer); i++ {
 		e := <-testClient.write
-		assert.Equalf(t, buffer[i], e, "%d", i)
+		assert.Equalf(t, buffer[i], e.line, "%d", i)
+	}
+}
+
+func Test_send_Retry(t *testing.T) {
+	tables := []struct {
+		responses []*client.ClientResponse
+		attempts  int
+		errors    []string
+		logger    []string
+	}{
+		{
+			responses: []*client.ClientResponse{
+				nil,
+				{StatusCode: 503, Response: "test"},
+				{StatusCode: 204},
+			},
+			attempts: 3,
+			errors: []string{
+				"retry: test",
+				"retry: request_id: , status_code: 503, error: test",
+			},
+			logger: []string{
+				"WARN client.send: size: 1, entries: 1, error: test",
+				"WARN send batch: retry: delay: 1ms",
+				"WARN client.send: request_id: , status_code: 503, size: 1, entries: 1, response: test",
+				"WARN send batch: retry: delay: 1ms",
+				"DEBUG send batch: request_id: , status_code: 204, size: 1, entries: 1",
+			},
+		},
+		{
+			responses: []*client.ClientResponse{
+				{StatusCode: 429, Response: "test"},
+				{StatusCode: 429, Response: "test"},
+				{StatusCode: 429, Response: "test"},
+			},
+			attempts: 3,
+			errors: []string{
+				"retry: request_id: , status_code: 429, error: test",
+				"retry: request_id: , status_code: 429, error: test",
+				"dropped: request_id: , status_code: 429, error: test",
+			},
+			logger: []string{
+				"WARN client.send: request_id: , status_code: 429, size: 1, entries: 1, response: test",
+				"WARN send batch: retry: delay: 1ms",
+				"WARN client.send: request_id: , status_code: 429, size: 1, entries: 1, response: test",
+				"WARN send batch: retry: delay: 1ms",
+				"WARN client.send: request_id: , status_code: 429, size: 1, entries: 1, response: test",
+				"ERROR send batch: dropped: request_id: , status_code: 429, size: 1, entries: 1",
+			},
+		},
+		{
+			responses: []*client.ClientResponse{
+				{StatusCode: 400, ResponseError: "test"},
+			},
+			attempts: 1,
+			errors: []string{
+				"dropped: request_id: , status_code: 400, error: test",
+			},
+			logger: []string{
+				"ERROR client.send: request_id: , status_code: 400, size: 1, entries: 1, error: test",
+				"ERROR send batch: dropped: request_id: , status_code: 400, size: 1, entries: 1",
+			},
+		},
+	}
+
+	for tt, table := range tables {
+		logger := &mockLogger{}
+
+		testBatch := &mocksBatch.Batch{}
+		testBatch.On("Reader").Return(&batch.BatchReader{
+			Reader:  strings.NewReader("1"),
+			Entries: 1,
+			Size:    1,
+		})
+		testBatch.On("Reset").Return()
+
+		attempt := 0
+		responses := table.responses
+		testClient := &mocksClient.Client{}
+		testClient.On("Send", mock.Anything, mock.Anything).Return(
+			func(_ context.Context, _ io.Reader) *client.ClientResponse {
+				attempt++
+				return responses[attempt-1]
+			},
+			func(_ context.Context, _ io.Reader) error {
+				if responses[attempt-1] == nil {
+					return errors.New("test")
+				}
+				return nil
+			},
+		)
+
+		writeErrors := make([]string, 0)
+
+		testWriter := &writer{
+			batch:  testBatch,
+			client: testClient,
+			retry: &retry.Options{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			},
+			errorHandler: func(err *WriteError) {
+				assert.Equalf(t, uint64(1), err.Size, "%d", tt)
+				assert.Equalf(t, uint64(1), err.Entries, "%d", tt)
+				switch {
+				case err.Retry:
+					writeErrors = append(writeErrors, "retry: "+err.Error())
+				case err.Dropped:
+					writeErrors = append(writeErrors, "dropped: "+err.Error())
+				}
+			},
+			logger: logger,
+		}
+
+		testWriter.send(testWriter.batch, nil)
+		assert.Equalf(t, table.attempts, attempt, "%d", tt)
+		assert.Equalf(t, table.errors, writeErrors, "%d", tt)
+		assert.Equalf(t, table.logger, logger.Lines, "%d", tt)
+		testBatch.AssertNumberOfCalls(t, "Reader", 1)
+		testBatch.AssertNumberOfCalls(t, "Reset", 1)
+	}
+}
+
+func Test_send_RetryAfter(t *testing.T) {
+	logger := &mockLogger{
+		InfoLines:  make([]string, 0),
+		ErrorLines: make([]string, 0),
+	}
+
+	testBatch := &mocksBatch.Batch{}
+	testBatch.On("Reader").Return(&batch.BatchReader{
+		Reader:  strings.NewReader("1"),
+		Entries: 1,
+		Size:    1,
+	})
+	testBatch.On("Reset").Return()
+
+	sent := make([]time.Time, 0)
+	testClient := &mocksClient.Client{}
+	testClient.On("Send", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, _ io.Reader) *client.ClientResponse {
+			sent = append(sent, time.Now())
+			if len(sent) == 1 {
+				return &client.ClientResponse{
+					StatusCode: 429,
+					RetryAfter: 50 * time.Millisecond,
+				}
+			}
+			return &client.ClientResponse{StatusCode: 204}
+		},
+		nil,
+	)
+
+	testWriter := &writer{
+		batch:  testBatch,
+		client: testClient,
+		retry: &retry.Options{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+		},
+		logger: logger,
+	}
+
+	testWriter.send(testWriter.batch, nil)
+	assert.Len(t, sent, 2)
+	assert.GreaterOrEqual(t, sent[1].Sub(sent[0]), 50*time.Millisecond)
+	assert.Len(t, logger.Lines, 4)
+	assert.Equal(t, "WARN send batch: retry: delay: 1ms", logger.Lines[1])
+	assert.Contains(t, logger.Lines[2], "WARN send batch: paused: delay: ")
+	assert.Equal(t, "DEBUG send batch: request_id: , status_code: 204, size: 1, entries: 1", logger.Lines[3])
+
+	for _, options := range []retry.Options{
+		{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+		{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxElapsedTime: 20 * time.Millisecond},
+	} {
+		options := options
+
+		testBatch.ExpectedCalls = nil
+		testBatch.On("Reader").Return(&batch.BatchReader{
+			Reader:  strings.NewReader("1"),
+			Entries: 1,
+			Size:    1,
+		})
+		testBatch.On("Reset").Return()
+
+		sent = sent[:0]
+		testWriter = &writer{
+			batch:  testBatch,
+			client: testClient,
+			retry:  &options,
+			logger: logger,
+		}
+
+		testWriter.send(testWriter.batch, nil)
+		assert.Len(t, sent, 2)
+		assert.Less(t, sent[1].Sub(sent[0]), 50*time.Millisecond)
+	}
+}
+
+func Test_send_Queue(t *testing.T) {
+	testQueue, err := queue.New(&queue.Options{Dir: t.TempDir()})
+	assert.Nil(t, err)
+
+	logger := &mockLogger{
+		InfoLines:  make([]string, 0),
+		ErrorLines: make([]string, 0),
+	}
+
+	statusCode := 503
+	received := make([]string, 0)
+	testClient := &mocksClient.Client{}
+	testClient.On("Send", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, reader io.Reader) *client.ClientResponse {
+			data, _ := ioutil.ReadAll(reader)
+			received = append(received, string(data))
+			return &client.ClientResponse{StatusCode: statusCode}
+		},
+		nil,
+	)
+
+	testWriter := &writer{
+		batch: batch.New(&batch.Options{
+			BufferSize:   100,
+			EntriesLimit: 10,
+		}),
+		client: testClient,
+		retry:  &retry.Options{},
+		queue:  testQueue,
+		logger: logger,
+	}
+
+	assert.Nil(t, testWriter.batch.Write([]byte("test1")))
+	testWriter.send(testWriter.batch, nil)
+	assert.Len(t, testQueue.Segments(), 1)
+
+	statusCode = 204
+	assert.Nil(t, testWriter.batch.Write([]byte("test2")))
+	testWriter.send(testWriter.batch, nil)
+	assert.Len(t, testQueue.Segments(), 1)
+
+	testWriter.replay(testQueue.Segments())
+	assert.Len(t, testQueue.Segments(), 0)
+	assert.Equal(t, []string{"test1\n", "test2\n", "test1\n"}, received)
+	assert.Equal(t, []string{
+		"WARN client.send: request_id: , status_code: 503, size: 6, entries: 1, response: ",
+		"ERROR send batch: kept: request_id: , status_code: 503, size: 6, entries: 1",
+		"DEBUG send batch: request_id: , status_code: 204, size: 6, entries: 1",
+		"INFO replay segment: segment: 00000000000000000000.seg",
+		"DEBUG send batch: request_id: , status_code: 204, size: 6, entries: 1",
+	}, logger.Lines)
+	assert.Equal(t, uint64(0), testWriter.Stats().DroppedEntries)
+}
+
+func Test_Flush(t *testing.T) {
+	tables := []struct {
+		response *client.ClientResponse
+		err      string
+	}{
+		{
+			response: &client.ClientResponse{StatusCode: 204},
+			err:      "",
+		},
+		{
+			response: &client.ClientResponse{StatusCode: 400, ResponseError: "test"},
+			err:      "request_id: , status_code: 400, error: test",
+		},
+	}
+
+	for tt, table := range tables {
+		testBatch := &mocksBatch.Batch{}
+		testBatch.On("Reader").Return(&batch.BatchReader{
+			Reader:  strings.NewReader("1"),
+			Entries: 1,
+			Size:    1,
+		})
+		testBatch.On("Entries").Return(uint64(1))
+		testBatch.On("Reset").Return()
+
+		nextBatch := &mocksBatch.Batch{}
+		nextBatch.On("Entries").Return(uint64(0))
+		nextBatch.On("Size").Return(uint64(0))
+
+		testClient := &mocksClient.Client{}
+		testClient.On("Send", mock.Anything, mock.Anything).Return(table.response, nil)
+
+		testWriter := &writer{
+			batch:        testBatch,
+			client:       testClient,
+			batches:      make(chan batch.Batch, 2),
+			pending:      make(chan *job, 1),
+			tracker:      newTracker(),
+			done:         make(chan struct{}),
+			write:        make(chan entry),
+			closing:      make(chan struct{}),
+			flush:        make(chan chan error),
+			sendInterval: time.Hour,
+			retry:        &retry.Options{},
+			logger:       &mockLogger{},
+		}
+		testWriter.batches <- nextBatch
+
+		go testWriter.run()
+		go testWriter.senders(1)
+
+		err := testWriter.Flush(context.Background())
+		if len(table.err) > 0 {
+			assert.EqualErrorf(t, err, table.err, "%d", tt)
+		} else {
+			assert.Nilf(t, err, "%d", tt)
+		}
+
+		close(testWriter.closing)
+		<-testWriter.done
+	}
+
+	testWriter := &writer{
+		flush: make(chan chan error),
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, testWriter.Flush(ctx))
+}
+
+func Test_Write_Sending(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 3)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- string(data)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&mockLogger{}).
+		SetSendInterval(time.Hour).
+		SetEntriesLimit(3))
+
+	written := make(chan struct{})
+	go func() {
+		for i := 1; i <= 5; i++ {
+			testWriter.WriteLine(fmt.Sprintf("test%d", i))
+		}
+		close(written)
+	}()
+
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("write is blocked while sending")
+	}
+
+	close(release)
+	testWriter.Close()
+
+	assert.Equal(t, "test1\ntest2\n", <-received)
+	assert.Equal(t, "test3\ntest4\n", <-received)
+	assert.Equal(t, "test5\n", <-received)
+}
+
+func Test_Write_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	testQueue, err := queue.New(&queue.Options{Dir: dir})
+	assert.Nil(t, err)
+	_, err = testQueue.Put([]byte("old\n"))
+	assert.Nil(t, err)
+
+	server := newBlockingServer()
+	defer server.Close()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetOrg("org").
+		SetLogger(&mockLogger{}).
+		SetQueueDir(dir))
+
+	<-server.first
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	testWriter.WriteLine("new")
+	assert.Nil(t, testWriter.Flush(ctx), "write is blocked while replaying")
+
+	close(server.release)
+	testWriter.Close()
+
+	assert.Equal(t, []string{"new\n", "old\n"}, server.received)
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	assert.Nil(t, err)
+	assert.Empty(t, segments)
+}
+
+func Test_Write_Concurrency(t *testing.T) {
+	release := make(chan struct{})
+	requests := make(chan struct{}, 3)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&mockLogger{}).
+		SetSendInterval(time.Hour).
+		SetEntriesLimit(2).
+		SetConcurrency(3))
+
+	for i := 1; i <= 4; i++ {
+		testWriter.WriteLine(fmt.Sprintf("test%d", i))
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-requests:
+		case <-time.After(time.Second):
+			t.Fatalf("%d batches are sent concurrently, expected 3", i)
+		}
+	}
+
+	flushed := make(chan error)
+	go func() {
+		flushed <- testWriter.Flush(context.Background())
+	}()
+
+	select {
+	case <-flushed:
+		t.Fatal("flush returned before batches are sent")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Nil(t, <-flushed)
+
+	testWriter.Close()
+}
+
+func Test_WriteContext(t *testing.T) {
+	testWriter := &writer{
+		write:    make(chan entry, 1),
+		closing:  make(chan struct{}),
+		validate: true,
+		logger:   &mockLogger{},
+	}
+
+	assert.Nil(t, testWriter.WriteContext(context.Background(), []byte("cpu value=1")))
+	assert.Equal(t, []byte("cpu value=1"), (<-testWriter.write).line)
+
+	assert.True(t, errors.Is(testWriter.WriteContext(context.Background(), []byte("cpu")), ErrInvalidLine))
+	assert.Len(t, testWriter.write, 0)
+
+	testWriter.write <- entry{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, testWriter.WriteContext(ctx, []byte("cpu value=2")))
+
+	testWriter.closed = true
+	assert.Equal(t, ErrClosed, testWriter.WriteContext(context.Background(), []byte("cpu value=2")))
+}
+
+func Test_TryWrite(t *testing.T) {
+	testWriter := &writer{
+		write:    make(chan entry, 1),
+		closing:  make(chan struct{}),
+		validate: true,
+		logger:   &mockLogger{},
+	}
+
+	assert.True(t, testWriter.TryWrite([]byte("cpu value=1")))
+	assert.False(t, testWriter.TryWrite([]byte("cpu value=2")))
+	assert.Equal(t, []byte("cpu value=1"), (<-testWriter.write).line)
+
+	assert.False(t, testWriter.TryWrite([]byte("cpu")))
+	assert.Len(t, testWriter.write, 0)
+
+	testWriter.closed = true
+	assert.False(t, testWriter.TryWrite([]byte("cpu value=3")))
+	assert.Len(t, testWriter.write, 0)
+}
+
+func Test_Write_Closed(t *testing.T) {
+	logger := &mockLogger{}
+	writeErrors := make([]*WriteError, 0)
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetLogger(logger).
+		SetErrorHandler(func(err *WriteError) {
+			writeErrors = append(writeErrors, err)
+		}))
+	testWriter.Close()
+	testWriter.Close()
+
+	assert.NotPanics(t, func() {
+		testWriter.WriteLine("cpu value=1")
+		testWriter.WritePoint(NewPoint("cpu").AddIntField("value", 1))
+	})
+	assert.Equal(t, ErrClosed, testWriter.WriteContext(context.Background(), []byte("cpu value=1")))
+	assert.False(t, testWriter.TryWrite([]byte("cpu value=1")))
+	assert.Equal(t, ErrClosed, testWriter.Flush(context.Background()))
+
+	assert.Equal(t, []string{
+		"write: size: 11, error: writer is closed",
+		"write: size: 0, error: writer is closed",
+	}, logger.ErrorLines)
+	assert.Equal(t, []string{"started", "stopped"}, logger.InfoLines)
+	assert.Len(t, writeErrors, 2)
+	assert.True(t, writeErrors[0].Dropped)
+	assert.Equal(t, uint64(2), testWriter.Stats().DroppedEntries)
+}
+
+func Test_Write_Validate(t *testing.T) {
+	logger := &mockLogger{}
+	writeErrors := make([]*WriteError, 0)
+
+	testWriter := &writer{
+		write:    make(chan entry, 2),
+		validate: true,
+		errorHandler: func(err *WriteError) {
+			writeErrors = append(writeErrors, err)
+		},
+		logger: logger,
+	}
+
+	testWriter.WriteLine("cpu value=1")
+	testWriter.WriteLine("cpu value=1\ncpu value=2")
+	testWriter.WriteLine("cpu")
+
+	assert.Len(t, testWriter.write, 1)
+	assert.Equal(t, []string{
+		"write line: size: 23, error: invalid line protocol at 11: line contains newline",
+		"write line: size: 3, error: invalid line protocol at 3: missing fields",
+	}, logger.ErrorLines)
+	assert.Len(t, writeErrors, 2)
+	assert.True(t, errors.Is(writeErrors[0], ErrInvalidLine))
+	assert.Equal(t, uint64(23), writeErrors[0].Size)
+	assert.True(t, writeErrors[1].Dropped)
+}
+
+func Test_WritePoint(t *testing.T) {
+	received := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- string(data)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	logger := &mockLogger{}
+	writeErrors := make([]error, 0)
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetPrecision("s").
+		SetLogger(logger).
+		SetErrorHandler(func(err *WriteError) {
+			writeErrors = append(writeErrors, err.Err)
+		}).
+		SetSendInterval(time.Hour))
+
+	testWriter.WritePoint(NewPoint("cpu").
+		AddTag("host", "test").
+		AddFloatField("value", 1.5).
+		SetTime(time.Unix(1600000000, 0)))
+	testWriter.WritePoint(NewPoint("cpu"))
+	testWriter.WriteLine("cpu value=2")
+	testWriter.Close()
+
+	assert.Equal(t, "cpu,host=test value=1.5 1600000000\ncpu value=2\n", <-received)
+	assert.Equal(t, []error{ErrNoFields}, writeErrors)
+	assert.Equal(t, []string{"write point: error: point: no fields"}, logger.ErrorLines)
+}
+
+func Test_salvage(t *testing.T) {
+	data := []byte("cpu value=1\ncpu value=\ncpu\ncpu value=4\n")
+
+	remainder, rejected := salvage(data, []client.LineError{
+		{Line: 2, Reason: "missing field value"},
+		{Text: "cpu", Reason: "missing fields"},
+		{Text: "test", Reason: "test"},
+	})
+	assert.Equal(t, "cpu value=1\ncpu value=4\n", string(remainder))
+	assert.Equal(t, []RejectedLine{
+		{Line: "cpu value=", Reason: "missing field value"},
+		{Line: "cpu", Reason: "missing fields"},
+	}, rejected)
+
+	remainder, rejected = salvage([]byte("cpu"), []client.LineError{{Line: 1, Reason: "test"}})
+	assert.Equal(t, "", string(remainder))
+	assert.Equal(t, []RejectedLine{{Line: "cpu", Reason: "test"}}, rejected)
+}
+
+func Test_deliver_Salvage(t *testing.T) {
+	tables := []struct {
+		responses []*client.ClientResponse
+		received  []string
+		err       string
+		rejected  int
+	}{
+		{
+			responses: []*client.ClientResponse{
+				{
+					StatusCode:    400,
+					ResponseError: "line 2: missing fields",
+					LineErrors:    []client.LineError{{Line: 2, Reason: "missing fields"}},
+				},
+				{StatusCode: 204},
+			},
+			received: []string{"a b=1\ncpu\nc d=1\n", "a b=1\nc d=1\n"},
+			rejected: 1,
+		},
+		{
+			responses: []*client.ClientResponse{
+				{
+					StatusCode:    400,
+					ResponseError: "line 2: missing fields",
+					LineErrors:    []client.LineError{{Line: 2, Reason: "missing fields"}},
+				},
+				{
+					StatusCode:    400,
+					ResponseError: "line 1: test",
+					LineErrors:    []client.LineError{{Line: 1, Reason: "test"}},
+				},
+			},
+			received: []string{"a b=1\ncpu\nc d=1\n", "a b=1\nc d=1\n"},
+			err:      "request_id: , status_code: 400, error: line 1: test",
+			rejected: 1,
+		},
+		{
+			responses: []*client.ClientResponse{
+				{
+					StatusCode:    400,
+					ResponseError: "partial write: unable to parse 'cpu': missing fields dropped=1",
+					LineErrors:    []client.LineError{{Text: "cpu", Reason: "missing fields"}},
+					Partial:       true,
+				},
+			},
+			received: []string{"a b=1\ncpu\nc d=1\n"},
+			rejected: 1,
+		},
+		{
+			responses: []*client.ClientResponse{
+				{
+					StatusCode:    400,
+					ResponseError: "test",
+				},
+			},
+			received: []string{"a b=1\ncpu\nc d=1\n"},
+			err:      "request_id: , status_code: 400, error: test",
+			rejected: 0,
+		},
+	}
+
+	for tt, table := range tables {
+		received := make([]string, 0)
+		responses := table.responses
+
+		testClient := &mocksClient.Client{}
+		testClient.On("Send", mock.Anything, mock.Anything).Return(
+			func(_ context.Context, reader io.Reader) *client.ClientResponse {
+				data, _ := ioutil.ReadAll(reader)
+				received = append(received, string(data))
+				return responses[len(received)-1]
+			},
+			nil,
+		)
+
+		rejected := 0
+		testWriter := &writer{
+			client: testClient,
+			retry:  &retry.Options{},
+			errorHandler: func(err *WriteError) {
+				rejected += len(err.Rejected)
+			},
+			logger: &mockLogger{},
+		}
+
+		err := testWriter.deliver(nil, []byte("a b=1\ncpu\nc d=1\n"), 3, false)
+		if len(table.err) == 0 {
+			assert.Nilf(t, err, "%d", tt)
+		} else {
+			assert.EqualErrorf(t, err, table.err, "%d", tt)
+		}
+		assert.Equalf(t, table.received, received, "%d", tt)
+		assert.Equalf(t, table.rejected, rejected, "%d", tt)
+	}
+}
+
+type mockDeadLetter struct {
+	data []string
+}
+
+func (d *mockDeadLetter) Put(data []byte, err *WriteError) error {
+	d.data = append(d.data, string(data))
+	return errors.New("test")
+}
+
+func Test_deliver_DeadLetter(t *testing.T) {
+	tables := []struct {
+		response  *client.ClientResponse
+		persisted bool
+		buried    []string
+	}{
+		{
+			response:  &client.ClientResponse{StatusCode: 400, ResponseError: "test"},
+			persisted: true,
+			buried:    []string{"a b=1\ncpu\n"},
+		},
+		{
+			response:  &client.ClientResponse{StatusCode: 500, ResponseError: "test"},
+			persisted: false,
+			buried:    []string{"a b=1\ncpu\n"},
+		},
+		{
+			response:  &client.ClientResponse{StatusCode: 500, ResponseError: "test"},
+			persisted: true,
+			buried:    nil,
+		},
+		{
+			response: &client.ClientResponse{
+				StatusCode:    400,
+				ResponseError: "test",
+				LineErrors:    []client.LineError{{Text: "cpu", Reason: "test"}},
+			},
+			persisted: true,
+			buried:    []string{"cpu\n", "a b=1\n"},
+		},
+	}
+
+	for tt, table := range tables {
+		testClient := &mocksClient.Client{}
+		testClient.On("Send", mock.Anything, mock.Anything).Return(table.response, nil)
+
+		logger := &mockLogger{}
+		deadLetter := &mockDeadLetter{}
+		testWriter := &writer{
+			client:     testClient,
+			retry:      &retry.Options{},
+			deadLetter: deadLetter,
+			logger:     logger,
+		}
+
+		testWriter.deliver(nil, []byte("a b=1\ncpu\n"), 2, table.persisted)
+		assert.Equalf(t, table.buried, deadLetter.data, "%d", tt)
+
+		if len(table.buried) > 0 {
+			assert.Containsf(t, logger.ErrorLines,
+				fmt.Sprintf("dead_letter.put: size: %d, error: test", len(table.buried[0])), "%d", tt)
+		}
+	}
+}
+
+func Test_enqueue_Overflow(t *testing.T) {
+	dropped := make([]string, 0)
+	testWriter := &writer{
+		write:    make(chan entry, 1),
+		overflow: OverflowDropNewest,
+		logger:   &mockLogger{},
+		errorHandler: func(err *WriteError) {
+			assert.Equal(t, ErrOverflow, err.Err)
+			assert.True(t, err.Dropped)
+			assert.Equal(t, uint64(1), err.Entries)
+			dropped = append(dropped, fmt.Sprint(err.Size))
+		},
+	}
+
+	assert.Nil(t, testWriter.WriteContext(context.Background(), []byte("cpu value=1")))
+	assert.Equal(t, ErrOverflow, testWriter.WriteContext(context.Background(), []byte("cpu value=2")))
+	assert.Equal(t, []byte("cpu value=1"), (<-testWriter.write).line)
+
+	testWriter.overflow = OverflowDropOldest
+
+	assert.Nil(t, testWriter.WriteContext(context.Background(), []byte("cpu value=3")))
+	assert.Nil(t, testWriter.WriteContext(context.Background(), []byte("cpu value=4")))
+	assert.Equal(t, []byte("cpu value=4"), (<-testWriter.write).line)
+
+	spill, err := newSpill(t.TempDir(), 0)
+	assert.Nil(t, err)
+	defer spill.close()
+
+	testWriter.overflow = OverflowSpill
+	testWriter.spill = spill
+	testWriter.encoder = &pointEncoder{}
+
+	testWriter.WritePoint(NewPoint("cpu").AddIntField("value", 5))
+	testWriter.WriteLine("cpu value=6")
+	assert.True(t, testWriter.TryWrite([]byte("cpu value=7")))
+	assert.NotNil(t, (<-testWriter.write).point)
+
+	path, err := spill.take()
+	assert.Nil(t, err)
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "cpu value=6\ncpu value=7\n", string(data))
+
+	testWriter.overflow = OverflowBlock
+
+	testWriter.write <- entry{}
+	assert.False(t, testWriter.TryWrite([]byte("cpu value=8")))
+
+	stats := testWriter.Stats()
+	assert.Equal(t, uint64(2), stats.LinesOverflowed)
+	assert.Equal(t, uint64(2), stats.DroppedEntries)
+	assert.Equal(t, uint64(2), stats.LinesSpilled)
+	assert.Equal(t, uint64(1), stats.InputQueueLength)
+	assert.Equal(t, []string{"11", "11"}, dropped)
+}
+
+func Test_enqueue_Closing(t *testing.T) {
+	testWriter := &writer{
+		write:    make(chan entry, 1),
+		closing:  make(chan struct{}),
+		overflow: OverflowDropNewest,
+		logger:   &mockLogger{},
+	}
+
+	// The error handler may close the writer, as Close takes the lock.
+	testWriter.errorHandler = func(err *WriteError) {
+		testWriter.lock.Lock()
+		testWriter.closed = true
+		testWriter.lock.Unlock()
+	}
+
+	testWriter.write <- entry{}
+	assert.Equal(t, ErrOverflow, testWriter.WriteContext(context.Background(), []byte("cpu value=1")))
+	assert.Equal(t, ErrClosed, testWriter.WriteContext(context.Background(), []byte("cpu value=2")))
+
+	testWriter = &writer{
+		write:    make(chan entry, 1),
+		closing:  make(chan struct{}),
+		overflow: OverflowBlock,
+		logger:   &mockLogger{},
+	}
+
+	testWriter.write <- entry{}
+
+	result := make(chan error)
+	go func() {
+		result <- testWriter.WriteContext(context.Background(), []byte("cpu value=3"))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// A blocked write holds neither Close nor new writes.
+	testWriter.lock.Lock()
+	testWriter.closed = true
+	close(testWriter.closing)
+	testWriter.lock.Unlock()
+
+	assert.Equal(t, ErrClosed, testWriter.WriteContext(context.Background(), []byte("cpu value=4")))
+	assert.Equal(t, ErrClosed, <-result)
+
+	testWriter.enqueuing.Wait()
+	assert.Len(t, testWriter.write, 1)
+}
+
+func Test_unspill(t *testing.T) {
+	spill, err := newSpill(t.TempDir(), 0)
+	assert.Nil(t, err)
+	defer spill.close()
+
+	testWriter := &writer{
+		batch:  batch.New(DefaultOptions().Batch),
+		spill:  spill,
+		logger: &mockLogger{},
+	}
+
+	assert.False(t, testWriter.unspill())
+
+	assert.Nil(t, spill.put("", []byte("cpu value=1")))
+	assert.Nil(t, spill.put("", []byte("cpu value=2")))
+
+	assert.False(t, testWriter.unspill())
+	assert.False(t, spill.pending())
+	assert.Equal(t, uint64(2), testWriter.batch.Entries())
+	assert.Equal(t, uint64(2), testWriter.Stats().BufferEntries)
+}
+
+func Test_Write_Spill(t *testing.T) {
+	received := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- string(data)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetServerURL(server.URL).
+		SetLogger(&mockLogger{}).
+		SetSendInterval(time.Hour).
+		SetInputQueueSize(1).
+		SetOverflowPolicy(OverflowSpill).
+		SetSpillDir(dir))
+
+	for i := 1; i <= 100; i++ {
+		testWriter.WriteLine(fmt.Sprintf("cpu value=%d", i))
+	}
+
+	testWriter.Close()
+
+	lines := 0
+	for len(received) > 0 {
+		lines += strings.Count(<-received, "\n")
+	}
+
+	assert.Equal(t, 100, lines)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, int64(0), files[0].Size())
+}
+
+func Test_Close_SpillFailed(t *testing.T) {
+	dir := t.TempDir()
+
+	// A directory in place of the taken file can be opened, but not read.
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, spillTakenName), 0o755))
+
+	logger := &mockLogger{}
+	testWriter := NewWriterWithOptions(DefaultOptions().
+		SetLogger(logger).
+		SetSendInterval(time.Hour).
+		SetOverflowPolicy(OverflowSpill).
+		SetSpillDir(dir))
+
+	testWriter.Close()
+
+	assert.Contains(t, logger.Lines, "ERROR spill: lines left: dir: "+dir)
+
+	info, err := os.Stat(filepath.Join(dir, spillTakenName))
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func Test_Shutdown(t *testing.T) {
+	statusCode := make(chan int, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := <-statusCode
+		statusCode <- code
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	newWriter := func(code int) Writer {
+		<-statusCode
+		statusCode <- code
+
+		return NewWriterWithOptions(DefaultOptions().
+			SetServerURL(server.URL).
+			SetLogger(&mockLogger{}).
+			SetSendInterval(time.Hour).
+			SetRetryInitialBackoff(time.Hour).
+			SetRetryMaxElapsedTime(time.Hour))
+	}
+
+	statusCode <- 0
+
+	testWriter := newWriter(204)
+	testWriter.WriteLine("cpu value=1")
+	testWriter.WriteLine("cpu value=2")
+	result, err := testWriter.Shutdown(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, ShutdownResult{Delivered: 2}, result)
+	assert.Equal(t, uint64(2), testWriter.Stats().EntriesSent)
+	assert.Equal(t, ErrClosed, testWriter.WriteContext(context.Background(), []byte("cpu value=3")))
+	_, err = testWriter.Shutdown(context.Background())
+	assert.Nil(t, err)
+
+	testWriter = newWriter(400)
+	testWriter.WriteLine("cpu value=1")
+	result, err = testWriter.Shutdown(context.Background())
+	assert.Equal(t, ShutdownResult{Lost: 1}, result)
+	assert.Equal(t, &ShutdownError{ShutdownResult: result}, err)
+
+	testWriter = newWriter(500)
+	testWriter.WriteLine("cpu value=1")
+	testWriter.WriteLine("cpu value=2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = testWriter.Shutdown(ctx)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, &ShutdownError{Err: context.DeadlineExceeded, ShutdownResult: ShutdownResult{Lost: 2}}, err)
+	assert.EqualError(t, err, "delivered: 0, lost: 2, error: context deadline exceeded")
+	testWriter.Close()
 }
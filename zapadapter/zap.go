@@ -0,0 +1,44 @@
+// Package zapadapter adapts a zap.Logger to writer.StructuredLogger.
+package zapadapter
+
+import (
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logger struct {
+	logger *zap.Logger
+}
+
+// New returns a writer.StructuredLogger logging fields with zap.Any.
+func New(l *zap.Logger) writer.StructuredLogger {
+	return &logger{logger: l}
+}
+
+func (l *logger) Log(level writer.Level, msg string, fields ...writer.Field) {
+	ce := l.logger.Check(zapLevel(level), msg)
+	if ce == nil {
+		return
+	}
+
+	zapFields := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		zapFields[i] = zap.Any(f.Key, f.Value)
+	}
+
+	ce.Write(zapFields...)
+}
+
+func zapLevel(level writer.Level) zapcore.Level {
+	switch level {
+	case writer.LevelDebug:
+		return zapcore.DebugLevel
+	case writer.LevelWarn:
+		return zapcore.WarnLevel
+	case writer.LevelError:
+		return zapcore.ErrorLevel
+	}
+
+	return zapcore.InfoLevel
+}
@@ -0,0 +1,37 @@
+package zapadapter
+
+import (
+	"errors"
+	"testing"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Log(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := New(zap.New(core))
+
+	l.Log(writer.LevelDebug, "send batch", writer.Field{Key: "size", Value: 10})
+	l.Log(writer.LevelInfo, "started")
+	l.Log(writer.LevelWarn, "send batch: retry", writer.Field{Key: "status_code", Value: 503})
+	l.Log(writer.LevelError, "client.send",
+		writer.Field{Key: "request_id", Value: "id"},
+		writer.Field{Key: "error", Value: errors.New("test")})
+
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	assert.Equal(t, "started", entries[0].Message)
+
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, map[string]interface{}{"status_code": int64(503)}, entries[1].ContextMap())
+
+	assert.Equal(t, zapcore.ErrorLevel, entries[2].Level)
+	assert.Equal(t, "client.send", entries[2].Message)
+	assert.Equal(t, map[string]interface{}{"request_id": "id", "error": "test"}, entries[2].ContextMap())
+}
@@ -0,0 +1,20 @@
+module github.com/a-kataev/go-influxdb-writer/zerologadapter
+
+go 1.17
+
+replace github.com/a-kataev/go-influxdb-writer => ../
+
+require (
+	github.com/a-kataev/go-influxdb-writer v0.1.0
+	github.com/rs/zerolog v1.28.0
+	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/mattn/go-colorable v0.1.12 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
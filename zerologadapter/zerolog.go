@@ -0,0 +1,48 @@
+// Package zerologadapter adapts a zerolog.Logger to writer.StructuredLogger.
+package zerologadapter
+
+import (
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/rs/zerolog"
+)
+
+type logger struct {
+	logger zerolog.Logger
+}
+
+// New returns a writer.StructuredLogger logging fields with Event.Interface,
+// errors are logged with Event.AnErr.
+func New(l zerolog.Logger) writer.StructuredLogger {
+	return &logger{logger: l}
+}
+
+func (l *logger) Log(level writer.Level, msg string, fields ...writer.Field) {
+	event := l.logger.WithLevel(zerologLevel(level))
+	if event == nil {
+		return
+	}
+
+	for _, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			event = event.AnErr(f.Key, err)
+			continue
+		}
+
+		event = event.Interface(f.Key, f.Value)
+	}
+
+	event.Msg(msg)
+}
+
+func zerologLevel(level writer.Level) zerolog.Level {
+	switch level {
+	case writer.LevelDebug:
+		return zerolog.DebugLevel
+	case writer.LevelWarn:
+		return zerolog.WarnLevel
+	case writer.LevelError:
+		return zerolog.ErrorLevel
+	}
+
+	return zerolog.InfoLevel
+}
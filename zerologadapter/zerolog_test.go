@@ -0,0 +1,28 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	writer "github.com/a-kataev/go-influxdb-writer"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Log(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(zerolog.New(buf).Level(zerolog.InfoLevel))
+
+	l.Log(writer.LevelDebug, "send batch", writer.Field{Key: "size", Value: 10})
+	l.Log(writer.LevelInfo, "started")
+	l.Log(writer.LevelWarn, "send batch: retry", writer.Field{Key: "status_code", Value: 503})
+	l.Log(writer.LevelError, "client.send",
+		writer.Field{Key: "request_id", Value: "id"},
+		writer.Field{Key: "error", Value: errors.New("test")})
+
+	assert.Equal(t, `{"level":"info","message":"started"}`+"\n"+
+		`{"level":"warn","status_code":503,"message":"send batch: retry"}`+"\n"+
+		`{"level":"error","request_id":"id","error":"test","message":"client.send"}`+"\n",
+		buf.String())
+}